@@ -0,0 +1,217 @@
+package api
+
+import (
+	"context"
+	crand "crypto/rand"
+	"errors"
+	"math/big"
+	"math/rand"
+
+	"github.com/franchesko/assembly-labyrinth/src/internal/config"
+	"github.com/franchesko/assembly-labyrinth/src/internal/emu"
+	"github.com/franchesko/assembly-labyrinth/src/internal/emu/diagnostic"
+	"github.com/franchesko/assembly-labyrinth/src/internal/emu/program"
+	"github.com/franchesko/assembly-labyrinth/src/internal/files"
+	"github.com/franchesko/assembly-labyrinth/src/internal/generator"
+)
+
+// testCase is one set of input values a submission is checked against.
+// Hidden cases are only reported as passed or failed.
+type testCase struct {
+	Name    string
+	Hidden  bool
+	Streams []emu.Stream
+}
+
+type caseResult struct {
+	Expected   []ioeStreamResponse
+	Out        []ioeStreamResponse
+	Stats      *program.Stats
+	Analysis   *program.Analysis
+	Mismatches []mismatchResponse
+	Warnings   diagnostic.List
+	TimedOut   bool
+	Passed     bool
+	Err        error
+}
+
+// runCase checks the submitted code against the output of the reference
+// solution on the inputs of tc. The returned error is only set when the
+// reference solution fails, problems of the submitted code are kept in
+// caseResult.Err.
+func runCase(ctx context.Context, cfg *config.Config, levelInfo files.LevelInfo, reference, nodesCode []emu.NodeCode, tc testCase) (*caseResult, error) {
+	levelInfo.Streams = tc.Streams
+	expected, err := runReference(ctx, cfg, levelInfo, reference)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &caseResult{
+		Expected: expected,
+		Out:      make([]ioeStreamResponse, 0),
+	}
+	out, err := runProgram(ctx, cfg, levelInfo, nodesCode)
+	if out != nil {
+		res.Warnings = out.Warnings
+	}
+	if err != nil {
+		res.TimedOut = errors.Is(err, program.ErrTimedOut)
+		res.Err = err
+		return res, nil
+	}
+
+	res.Stats = &out.Stats
+	res.Analysis = &out.Analysis
+	for _, outStream := range out.Output {
+		res.Out = append(res.Out, ioeStreamResponse{
+			Index:  outStream.Index,
+			Values: outStream.Values,
+		})
+	}
+	res.Mismatches = checkResult(expected, res.Out, out.Emitted)
+	res.Passed = len(res.Mismatches) == 0
+	return res, nil
+}
+
+// hiddenCases generates count cases from seeds drawn with crypto/rand, so
+// the hidden inputs can neither be chosen nor predicted by the player.
+func hiddenCases(streams []emu.Stream, count int) ([]testCase, error) {
+	cases := make([]testCase, 0, count)
+	for range count {
+		seed, err := crand.Int(crand.Reader, big.NewInt(maxSeed))
+		if err != nil {
+			return nil, err
+		}
+		hidden := make([]emu.Stream, len(streams))
+		copy(hidden, streams)
+		generator.Generate(hidden, seed.Int64())
+		cases = append(cases, testCase{
+			Hidden:  true,
+			Streams: hidden,
+		})
+	}
+	return cases, nil
+}
+
+// fixedCases builds the hand-written cases of the level. Input streams a
+// case leaves out are generated from rng, derived ones follow the values of
+// the case.
+func fixedCases(streams []emu.Stream, tests []files.TestCase, rng *rand.Rand) []testCase {
+	cases := make([]testCase, 0, len(tests))
+	for _, test := range tests {
+		fixed := make([]emu.Stream, len(streams))
+		copy(fixed, streams)
+		seed := rng.Int63n(maxSeed)
+		generator.Generate(fixed, seed)
+		test.Apply(fixed)
+		generator.Rederive(fixed, test.Overrides(), seed)
+		cases = append(cases, testCase{
+			Name:    test.Name,
+			Streams: fixed,
+		})
+	}
+	return cases
+}
+
+func runProgram(ctx context.Context, cfg *config.Config, levelInfo files.LevelInfo, nodesCode []emu.NodeCode) (*program.Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, cfg.RunTimeout)
+	defer cancel()
+
+	return program.Run(ctx, levelInfo.Layout, levelInfo.Streams, nodesCode, program.Options{
+		MaxCycles: cfg.MaxCycles,
+	})
+}
+
+// runReference runs the reference solution of the level on the input
+// values set in levelInfo and returns its output as the expected one.
+func runReference(ctx context.Context, cfg *config.Config, levelInfo files.LevelInfo, reference []emu.NodeCode) ([]ioeStreamResponse, error) {
+	res, err := runProgram(ctx, cfg, levelInfo, reference)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[uint8]string)
+	for _, stream := range levelInfo.Streams {
+		if stream.Type == emu.OUT {
+			names[stream.Index] = stream.Name
+		}
+	}
+
+	expected := make([]ioeStreamResponse, 0)
+	for _, stream := range res.Output {
+		expected = append(expected, ioeStreamResponse{
+			Index:  stream.Index,
+			Name:   names[stream.Index],
+			Values: stream.Values,
+		})
+	}
+	return expected, nil
+}
+
+func inputStreams(streams []emu.Stream) []ioeStreamResponse {
+	in := make([]ioeStreamResponse, 0)
+	for _, stream := range streams {
+		if stream.Type == emu.IN {
+			in = append(in, ioeStreamResponse{
+				Index:  stream.Index,
+				Name:   stream.Name,
+				Values: stream.Values,
+			})
+		}
+	}
+	return in
+}
+
+// incomplete reports whether an output stream has fewer values than
+// expected.
+func incomplete(expected, out []ioeStreamResponse) bool {
+	produced := make(map[uint8]int)
+	for _, stream := range out {
+		produced[stream.Index] = len(stream.Values)
+	}
+	for _, stream := range expected {
+		if produced[stream.Index] < len(stream.Values) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkResult compares the output with the expected one and returns the
+// first mismatch of every output stream that differs.
+func checkResult(expected, out []ioeStreamResponse, emitted map[uint8][]int) []mismatchResponse {
+	produced := make(map[uint8][]int16)
+	for _, stream := range out {
+		produced[stream.Index] = stream.Values
+	}
+
+	mismatches := make([]mismatchResponse, 0)
+	for _, stream := range expected {
+		values := produced[stream.Index]
+		position := 0
+		for position < len(stream.Values) && position < len(values) && stream.Values[position] == values[position] {
+			position++
+		}
+		if position == len(stream.Values) && position == len(values) {
+			continue
+		}
+
+		mismatch := mismatchResponse{
+			Stream:   stream.Index,
+			Index:    position,
+			TooShort: len(values) < len(stream.Values),
+			TooLong:  len(values) > len(stream.Values),
+		}
+		if position < len(stream.Values) {
+			mismatch.Expected = &stream.Values[position]
+		}
+		if position < len(values) {
+			mismatch.Actual = &values[position]
+			if cycles := emitted[stream.Index]; position < len(cycles) {
+				mismatch.Cycle = cycles[position]
+			}
+		}
+		mismatches = append(mismatches, mismatch)
+	}
+	return mismatches
+}
@@ -0,0 +1,352 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/franchesko/assembly-labyrinth/src/internal/config"
+	"github.com/franchesko/assembly-labyrinth/src/internal/debug"
+	"github.com/franchesko/assembly-labyrinth/src/internal/emu"
+	"github.com/franchesko/assembly-labyrinth/src/internal/emu/program"
+	"github.com/franchesko/assembly-labyrinth/src/internal/levels"
+	"github.com/franchesko/assembly-labyrinth/src/internal/progress"
+	"github.com/gorilla/mux"
+)
+
+type DebugSessionResponse struct {
+	ID          string               `json:"id"`
+	Level       string               `json:"level"`
+	Breakpoints []breakpointResponse `json:"breakpoints"`
+	Watches     []watchResponse      `json:"watches"`
+	Stop        debug.StopReason     `json:"stop"`
+	Breakpoint  *breakpointResponse  `json:"breakpoint,omitempty"`
+	Watch       *watchResponse       `json:"watch,omitempty"`
+	Message     string               `json:"message,omitempty"`
+	State       debugStateResponse   `json:"state"`
+}
+
+type debugStateResponse struct {
+	Cycle   int                   `json:"cycle"`
+	Halted  bool                  `json:"halted"`
+	Nodes   []debugNodeResponse   `json:"nodes"`
+	Streams []debugStreamResponse `json:"streams"`
+}
+
+type debugNodeResponse struct {
+	Index          uint8                  `json:"index"`
+	Damaged        bool                   `json:"damaged"`
+	CursorPosition uint8                  `json:"cursor_position"`
+	Line           int                    `json:"line"`
+	ACC            int16                  `json:"acc"`
+	BAK            int16                  `json:"bak"`
+	Blocked        bool                   `json:"blocked"`
+	OutputPort     *emu.LocationDirection `json:"output_port,omitempty"`
+	OutputValue    *int16                 `json:"output_value,omitempty"`
+}
+
+type debugStreamResponse struct {
+	Index    uint8          `json:"index"`
+	Type     emu.StreamType `json:"type"`
+	Position int            `json:"position"`
+	Length   int            `json:"length,omitempty"`
+	Values   []int16        `json:"values,omitempty"`
+}
+
+type breakpointResponse struct {
+	Node uint8 `json:"node"`
+	Line int   `json:"line"`
+}
+
+type watchResponse struct {
+	Kind       debug.WatchKind  `json:"kind"`
+	Node       uint8            `json:"node"`
+	Register   debug.Register   `json:"register"`
+	Comparison debug.Comparison `json:"comparison"`
+	Value      int16            `json:"value"`
+	Stream     uint8            `json:"stream"`
+}
+
+type debugSessionRequest struct {
+	runLevelRequest
+	debugConditionsRequest
+}
+
+type debugConditionsRequest struct {
+	Breakpoints []breakpointResponse `json:"breakpoints"`
+	Watches     []watchResponse      `json:"watches"`
+}
+
+type debugStepRequest struct {
+	Cycles int `json:"cycles"`
+}
+
+func GetCreateDebugSessionHandler(cfg *config.Config, cache *levels.Cache, tracker *progress.Tracker, sessions *debug.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Content-Type", "application/json")
+		params := mux.Vars(r)
+		level, ok := resolveLevel(w, cache.Snapshot(), params["level"])
+		if !ok {
+			return
+		}
+
+		var req debugSessionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, MALFORMED_REQUEST, "Wrong request format", err.Error())
+			return
+		}
+
+		levelInfo := level.Info()
+		player := r.Header.Get(progress.PlayerHeader)
+		if tracker.Locked(player, levelInfo.Prerequisites) {
+			writeError(w, http.StatusForbidden, LEVEL_LOCKED, "Level is locked", levelInfo.Prerequisites)
+			return
+		}
+		if problems := applyInputs(levelInfo.Streams, req.Seed, req.In); len(problems) > 0 {
+			writeError(w, http.StatusBadRequest, INVALID_REQUEST, "Wrong input values", problems)
+			return
+		}
+
+		reference, err := runProgram(r.Context(), cfg, levelInfo, level.Reference)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, INTERNAL_ERROR, "Unable to get expected values", nil)
+			return
+		}
+		prog, err := program.Load(levelInfo.Layout, levelInfo.Streams, req.Nodes)
+		if err != nil {
+			writeCodeError(w, err)
+			return
+		}
+		session, err := sessions.Create(params["level"], prog, debug.Options{
+			MaxCycles: cfg.MaxCycles,
+			Expected:  reference.Output,
+		})
+		if errors.Is(err, debug.ErrTooManySessions) {
+			writeError(w, http.StatusServiceUnavailable, TOO_MANY_SESSIONS, "Too many debug sessions", nil)
+			return
+		} else if err != nil {
+			writeError(w, http.StatusInternalServerError, INTERNAL_ERROR, "Unable to create debug session", nil)
+			return
+		}
+
+		if err := setConditions(session, req.debugConditionsRequest); err != nil {
+			sessions.Delete(session.ID)
+			writeError(w, http.StatusBadRequest, INVALID_REQUEST, "Wrong breakpoints or watches", err.Error())
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(newDebugSessionResponse(session, &debug.Result{
+			State: session.State(),
+			Stop:  debug.STEPPED,
+		}))
+	}
+}
+
+func GetDebugSessionHandler(sessions *debug.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Content-Type", "application/json")
+		session, ok := findSession(w, r, sessions)
+		if !ok {
+			return
+		}
+
+		json.NewEncoder(w).Encode(newDebugSessionResponse(session, &debug.Result{
+			State: session.State(),
+			Stop:  debug.STEPPED,
+		}))
+	}
+}
+
+func GetSetDebugConditionsHandler(sessions *debug.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Content-Type", "application/json")
+		session, ok := findSession(w, r, sessions)
+		if !ok {
+			return
+		}
+
+		var req debugConditionsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, MALFORMED_REQUEST, "Wrong request format", err.Error())
+			return
+		}
+		if err := setConditions(session, req); err != nil {
+			writeError(w, http.StatusBadRequest, INVALID_REQUEST, "Wrong breakpoints or watches", err.Error())
+			return
+		}
+
+		json.NewEncoder(w).Encode(newDebugSessionResponse(session, &debug.Result{
+			State: session.State(),
+			Stop:  debug.STEPPED,
+		}))
+	}
+}
+
+func GetStepDebugSessionHandler(cfg *config.Config, sessions *debug.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Content-Type", "application/json")
+		session, ok := findSession(w, r, sessions)
+		if !ok {
+			return
+		}
+
+		req := debugStepRequest{
+			Cycles: 1,
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			writeError(w, http.StatusBadRequest, MALFORMED_REQUEST, "Wrong request format", err.Error())
+			return
+		}
+		if req.Cycles < 1 {
+			writeError(w, http.StatusBadRequest, INVALID_REQUEST, "Cycles must be positive", nil)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), cfg.RunTimeout)
+		defer cancel()
+		res, err := session.Step(ctx, req.Cycles)
+		if err != nil {
+			writeCodeError(w, err)
+			return
+		}
+
+		json.NewEncoder(w).Encode(newDebugSessionResponse(session, res))
+	}
+}
+
+func GetContinueDebugSessionHandler(cfg *config.Config, sessions *debug.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Content-Type", "application/json")
+		session, ok := findSession(w, r, sessions)
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), cfg.RunTimeout)
+		defer cancel()
+		res, err := session.Continue(ctx)
+		if err != nil {
+			writeCodeError(w, err)
+			return
+		}
+
+		json.NewEncoder(w).Encode(newDebugSessionResponse(session, res))
+	}
+}
+
+func GetDeleteDebugSessionHandler(sessions *debug.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		params := mux.Vars(r)
+		if !sessions.Delete(params["session"]) {
+			writeError(w, http.StatusNotFound, SESSION_NOT_FOUND, "Debug session not found", nil)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func findSession(w http.ResponseWriter, r *http.Request, sessions *debug.Store) (*debug.Session, bool) {
+	params := mux.Vars(r)
+	session, ok := sessions.Get(params["session"])
+	if !ok {
+		writeError(w, http.StatusNotFound, SESSION_NOT_FOUND, "Debug session not found", nil)
+	}
+	return session, ok
+}
+
+func setConditions(session *debug.Session, req debugConditionsRequest) error {
+	breakpoints := make([]debug.Breakpoint, 0, len(req.Breakpoints))
+	for _, bp := range req.Breakpoints {
+		breakpoints = append(breakpoints, debug.Breakpoint{
+			Node: bp.Node,
+			Line: bp.Line,
+		})
+	}
+	watches := make([]debug.Watch, 0, len(req.Watches))
+	for _, watch := range req.Watches {
+		watches = append(watches, debug.Watch(watch))
+	}
+	return session.SetConditions(breakpoints, watches)
+}
+
+func newDebugSessionResponse(session *debug.Session, res *debug.Result) DebugSessionResponse {
+	breakpoints, watches := session.Conditions()
+	resp := DebugSessionResponse{
+		ID:          session.ID,
+		Level:       session.Level,
+		Breakpoints: make([]breakpointResponse, 0, len(breakpoints)),
+		Watches:     make([]watchResponse, 0, len(watches)),
+		Stop:        res.Stop,
+		Message:     res.Message,
+		State:       newDebugStateResponse(res.State),
+	}
+	for _, bp := range breakpoints {
+		resp.Breakpoints = append(resp.Breakpoints, breakpointResponse(bp))
+	}
+	for _, watch := range watches {
+		resp.Watches = append(resp.Watches, watchResponse(watch))
+	}
+	if res.Breakpoint != nil {
+		bp := breakpointResponse(*res.Breakpoint)
+		resp.Breakpoint = &bp
+	}
+	if res.Watch != nil {
+		watch := watchResponse(*res.Watch)
+		resp.Watch = &watch
+	}
+	return resp
+}
+
+func newDebugStateResponse(state program.State) debugStateResponse {
+	nodes := make([]debugNodeResponse, 0, len(state.Nodes))
+	for _, n := range state.Nodes {
+		node := debugNodeResponse{
+			Index:          n.Index,
+			Damaged:        n.Damaged,
+			CursorPosition: n.CursorPosition,
+			Line:           n.Line,
+			ACC:            n.ACC,
+			BAK:            n.BAK,
+			Blocked:        n.Blocked,
+		}
+		if n.Writing {
+			node.OutputPort = &n.OutputPort
+			node.OutputValue = &n.OutputValue
+		}
+		nodes = append(nodes, node)
+	}
+
+	streams := make([]debugStreamResponse, 0, len(state.Streams))
+	for _, stream := range state.Streams {
+		streams = append(streams, debugStreamResponse{
+			Index:    stream.Index,
+			Type:     stream.Type,
+			Position: stream.Position,
+			Length:   stream.Length,
+			Values:   stream.Values,
+		})
+	}
+
+	return debugStateResponse{
+		Cycle:   state.Cycle,
+		Halted:  state.Halted,
+		Nodes:   nodes,
+		Streams: streams,
+	}
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/franchesko/assembly-labyrinth/src/internal/emu/diagnostic"
+)
+
+type ErrorCode string
+
+const (
+	MALFORMED_REQUEST  ErrorCode = "malformed_request"
+	INVALID_REQUEST    ErrorCode = "invalid_request"
+	NOT_FOUND          ErrorCode = "not_found"
+	METHOD_NOT_ALLOWED ErrorCode = "method_not_allowed"
+	LEVEL_NOT_FOUND    ErrorCode = "level_not_found"
+	LEVEL_LOCKED       ErrorCode = "level_locked"
+	INVALID_CODE       ErrorCode = "invalid_code"
+	SESSION_NOT_FOUND  ErrorCode = "session_not_found"
+	TOO_MANY_SESSIONS  ErrorCode = "too_many_sessions"
+	INTERNAL_ERROR     ErrorCode = "internal_error"
+)
+
+// ErrorResponse is the body of every error returned by the API. Details
+// carry data specific to the code, such as the diagnostics of invalid code.
+type ErrorResponse struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+	Details any       `json:"details,omitempty"`
+}
+
+func writeError(w http.ResponseWriter, status int, code ErrorCode, message string, details any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorResponse{
+		Code:    code,
+		Message: message,
+		Details: details,
+	})
+}
+
+// writeCodeError reports code that cannot be run, with the diagnostics of
+// the code as details if it does not compile.
+func writeCodeError(w http.ResponseWriter, err error) {
+	var diags diagnostic.List
+	if errors.As(err, &diags) {
+		writeError(w, http.StatusUnprocessableEntity, INVALID_CODE, "Code is invalid", diags)
+		return
+	}
+	writeError(w, http.StatusUnprocessableEntity, INVALID_CODE, err.Error(), nil)
+}
+
+func NotFoundHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		writeError(w, http.StatusNotFound, NOT_FOUND, "Not found", nil)
+	}
+}
+
+func MethodNotAllowedHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		writeError(w, http.StatusMethodNotAllowed, METHOD_NOT_ALLOWED, "Method not allowed", nil)
+	}
+}
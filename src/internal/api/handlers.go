@@ -2,34 +2,67 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"math/rand"
 	"net/http"
+	"strconv"
 
 	"github.com/franchesko/assembly-labyrinth/src/internal/config"
 	"github.com/franchesko/assembly-labyrinth/src/internal/emu"
+	"github.com/franchesko/assembly-labyrinth/src/internal/emu/diagnostic"
 	"github.com/franchesko/assembly-labyrinth/src/internal/emu/program"
-	"github.com/franchesko/assembly-labyrinth/src/internal/files"
+	"github.com/franchesko/assembly-labyrinth/src/internal/generator"
+	"github.com/franchesko/assembly-labyrinth/src/internal/levels"
+	"github.com/franchesko/assembly-labyrinth/src/internal/progress"
 	"github.com/gorilla/mux"
 )
 
 type LevelsResponse struct {
-	Levels []string `json:"levels"`
+	Levels    []string             `json:"levels"`
+	Catalogue []levelEntryResponse `json:"catalogue"`
 }
 
 type LevelInfoResponse struct {
 	Title       string               `json:"title"`
 	Description string               `json:"description"`
+	Seed        int64                `json:"seed"`
 	Layout      []nodeLayoutResponse `json:"layout"`
 	In          []ioeStreamResponse  `json:"in"`
 	Expected    []ioeStreamResponse  `json:"expected"`
 }
 
 type RunLevelResponse struct {
-	CodeValidation bool                `json:"code_validation"`
-	CheckStatus    bool                `json:"check_status"`
-	In             []ioeStreamResponse `json:"in"`
-	Expected       []ioeStreamResponse `json:"expected"`
-	Out            []ioeStreamResponse `json:"out"`
+	CheckStatus bool                `json:"check_status"`
+	TimedOut    bool                `json:"timed_out"`
+	Stats       *statsResponse      `json:"stats,omitempty"`
+	Deadlock    *deadlockResponse   `json:"deadlock,omitempty"`
+	Mismatches  []mismatchResponse  `json:"mismatches,omitempty"`
+	Warnings    diagnostic.List     `json:"warnings,omitempty"`
+	Seed        *int64              `json:"seed,omitempty"`
+	Cases       []caseResponse      `json:"cases"`
+	In          []ioeStreamResponse `json:"in"`
+	Expected    []ioeStreamResponse `json:"expected"`
+	Out         []ioeStreamResponse `json:"out"`
+}
+
+type ProgressResponse struct {
+	Player string                `json:"player"`
+	Levels []levelStatusResponse `json:"levels"`
+}
+
+type levelEntryResponse struct {
+	ID            string   `json:"id"`
+	Title         string   `json:"title"`
+	Difficulty    uint8    `json:"difficulty,omitempty"`
+	Tags          []string `json:"tags"`
+	Order         int      `json:"order,omitempty"`
+	Prerequisites []string `json:"prerequisites"`
+}
+
+type levelStatusResponse struct {
+	ID     string `json:"id"`
+	Solved bool   `json:"solved"`
+	Locked bool   `json:"locked"`
 }
 
 type nodeLayoutResponse struct {
@@ -43,40 +76,102 @@ type ioeStreamResponse struct {
 	Values []int16 `json:"values"`
 }
 
+type caseResponse struct {
+	Index    int    `json:"index"`
+	Name     string `json:"name,omitempty"`
+	Hidden   bool   `json:"hidden"`
+	Passed   bool   `json:"passed"`
+	TimedOut bool   `json:"timed_out"`
+}
+
+// deadlockResponse explains why a program stopped before producing every
+// expected output value.
+type deadlockResponse struct {
+	Messages  []string       `json:"messages"`
+	Waits     []waitResponse `json:"waits"`
+	Deadlocks [][]int        `json:"deadlocks"`
+}
+
+type waitResponse struct {
+	Node       uint8                 `json:"node"`
+	Kind       program.WaitKind      `json:"kind"`
+	Port       emu.LocationDirection `json:"port"`
+	Peer       program.PeerKind      `json:"peer"`
+	PeerIndex  uint8                 `json:"peer_index"`
+	Deadlocked bool                  `json:"deadlocked"`
+}
+
+// mismatchResponse points at the first wrong value of an output stream.
+// Expected is missing when the output is too long, Actual and Cycle when it
+// is too short.
+type mismatchResponse struct {
+	Stream   uint8  `json:"stream"`
+	Index    int    `json:"index"`
+	Expected *int16 `json:"expected,omitempty"`
+	Actual   *int16 `json:"actual,omitempty"`
+	TooShort bool   `json:"too_short"`
+	TooLong  bool   `json:"too_long"`
+	Cycle    int    `json:"cycle,omitempty"`
+}
+
+type statsResponse struct {
+	Cycles       int `json:"cycles"`
+	Nodes        int `json:"nodes"`
+	Instructions int `json:"instructions"`
+}
+
 type runLevelRequest struct {
-	Nodes    []emu.NodeCode      `json:"nodes"`
-	In       []ioeStreamResponse `json:"in"`
-	Expected []ioeStreamResponse `json:"expected"`
+	Nodes []emu.NodeCode      `json:"nodes"`
+	Seed  *int64              `json:"seed"`
+	In    []ioeStreamResponse `json:"in"`
 }
 
-func GetLevelsHandler(cfg *config.Config) http.HandlerFunc {
+// maxSeed keeps generated seeds within the integers a JavaScript client
+// can represent exactly.
+const maxSeed = 1<<53 - 1
+
+func GetLevelsHandler(cache *levels.Cache) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
 		w.Header().Set("Content-Type", "application/json")
 
-		levels, err := files.LoadLevels(cfg.LevelPath)
-		if err != nil {
-			http.Error(w, "Unable to load levels", http.StatusInternalServerError)
-			return
+		entries := cache.Snapshot().Catalogue
+		ids := make([]string, 0, len(entries))
+		catalogue := make([]levelEntryResponse, 0, len(entries))
+		for _, entry := range entries {
+			ids = append(ids, entry.ID)
+			catalogue = append(catalogue, newLevelEntryResponse(entry))
 		}
 
-		json.NewEncoder(w).Encode(LevelsResponse{Levels: levels})
+		json.NewEncoder(w).Encode(LevelsResponse{
+			Levels:    ids,
+			Catalogue: catalogue,
+		})
 	}
 }
 
-func GetLevelInfoHandler(cfg *config.Config) http.HandlerFunc {
+func GetLevelInfoHandler(cfg *config.Config, cache *levels.Cache) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
 		w.Header().Set("Content-Type", "application/json")
 		params := mux.Vars(r)
-
-		levelInfo, err := files.LoadLevelInfo(cfg.LevelPath + "/" + params["level"] + ".json")
-		if err != nil {
-			http.Error(w, "Unable to load level", http.StatusInternalServerError)
+		level, ok := resolveLevel(w, cache.Snapshot(), params["level"])
+		if !ok {
 			return
 		}
+
+		seed := rand.Int63n(maxSeed)
+		if query := r.URL.Query().Get("seed"); query != "" {
+			var err error
+			if seed, err = strconv.ParseInt(query, 10, 64); err != nil {
+				writeError(w, http.StatusBadRequest, INVALID_REQUEST, "Wrong seed format", err.Error())
+				return
+			}
+		}
+
+		levelInfo := level.Info()
 		layout := make([]nodeLayoutResponse, 0)
 		for _, nl := range levelInfo.Layout {
 			layout = append(layout, nodeLayoutResponse{
@@ -85,129 +180,214 @@ func GetLevelInfoHandler(cfg *config.Config) http.HandlerFunc {
 			})
 		}
 
-		in := make([]ioeStreamResponse, 0)
-		out := make([]ioeStreamResponse, 0)
-		for i := range levelInfo.Streams {
-			if levelInfo.Streams[i].Type == emu.IN {
-				levelInfo.Streams[i].Values = generateValues(int(levelInfo.Streams[i].MinValue), int(levelInfo.Streams[i].MaxValue))
-				in = append(in, ioeStreamResponse{
-					Index:  levelInfo.Streams[i].Index,
-					Name:   levelInfo.Streams[i].Name,
-					Values: levelInfo.Streams[i].Values,
-				})
-			} else {
-				out = append(out, ioeStreamResponse{
-					Index: levelInfo.Streams[i].Index,
-					Name:  levelInfo.Streams[i].Name,
-				})
-			}
-		}
+		generator.Generate(levelInfo.Streams, seed)
+		in := inputStreams(levelInfo.Streams)
 
-		code, err := files.LoadNodesCode(cfg.CodePath + "/" + params["level"] + ".json")
-		if err != nil {
-			http.Error(w, "Unable to load level code", http.StatusInternalServerError)
-			return
-		}
-		expected, err := program.Run(levelInfo.Streams, code)
+		expected, err := runReference(r.Context(), cfg, levelInfo, level.Reference)
 		if err != nil {
-			http.Error(w, "Unable to get expected values", http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, INTERNAL_ERROR, "Unable to get expected values", nil)
 			return
 		}
 
-		expRes := make([]ioeStreamResponse, 0)
-		for i, expStream := range expected {
-			expRes = append(expRes, ioeStreamResponse{
-				Index:  out[i].Index,
-				Name:   out[i].Name,
-				Values: expStream.Values,
-			})
-		}
-
 		json.NewEncoder(w).Encode(LevelInfoResponse{
 			Title:       levelInfo.Title,
 			Description: levelInfo.Description,
+			Seed:        seed,
 			Layout:      layout,
 			In:          in,
-			Expected:    expRes,
+			Expected:    expected,
+		})
+	}
+}
+
+func GetProgressHandler(cache *levels.Cache, tracker *progress.Tracker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Content-Type", "application/json")
+
+		player := r.Header.Get(progress.PlayerHeader)
+		if player == "" {
+			writeError(w, http.StatusBadRequest, INVALID_REQUEST, "Player is not specified", nil)
+			return
+		}
+
+		entries := cache.Snapshot().Catalogue
+		status := make([]levelStatusResponse, 0, len(entries))
+		for _, level := range tracker.Status(player, entries) {
+			status = append(status, levelStatusResponse{
+				ID:     level.ID,
+				Solved: level.Solved,
+				Locked: level.Locked,
+			})
+		}
+
+		json.NewEncoder(w).Encode(ProgressResponse{
+			Player: player,
+			Levels: status,
 		})
 	}
 }
 
-func GetRunLevelHandler(cfg *config.Config) http.HandlerFunc {
+func GetRunLevelHandler(cfg *config.Config, cache *levels.Cache, tracker *progress.Tracker) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
 		w.Header().Set("Content-Type", "application/json")
 		params := mux.Vars(r)
+		level, ok := resolveLevel(w, cache.Snapshot(), params["level"])
+		if !ok {
+			return
+		}
 
 		var runLevel runLevelRequest
 		if err := json.NewDecoder(r.Body).Decode(&runLevel); err != nil {
-			http.Error(w, "Wrong request format", http.StatusBadRequest)
+			writeError(w, http.StatusBadRequest, MALFORMED_REQUEST, "Wrong request format", err.Error())
 			return
 		}
 
-		codeValidation := true
-		status := true
-		levelInfo, err := files.LoadLevelInfo(cfg.LevelPath + "/" + params["level"] + ".json")
+		levelInfo := level.Info()
+		player := r.Header.Get(progress.PlayerHeader)
+		if tracker.Locked(player, levelInfo.Prerequisites) {
+			writeError(w, http.StatusForbidden, LEVEL_LOCKED, "Level is locked", levelInfo.Prerequisites)
+			return
+		}
+
+		visible := testCase{
+			Streams: levelInfo.Streams,
+		}
+		if problems := applyInputs(visible.Streams, runLevel.Seed, runLevel.In); len(problems) > 0 {
+			writeError(w, http.StatusBadRequest, INVALID_REQUEST, "Wrong input values", problems)
+			return
+		}
+		rng := rand.New(rand.NewSource(rand.Int63()))
+		if runLevel.Seed != nil {
+			rng = rand.New(rand.NewSource(*runLevel.Seed))
+		}
+		cases := []testCase{visible}
+		cases = append(cases, fixedCases(levelInfo.Streams, levelInfo.Tests, rng)...)
+		hidden, err := hiddenCases(levelInfo.Streams, cfg.HiddenCases)
 		if err != nil {
-			http.Error(w, "Unable to load level", http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, INTERNAL_ERROR, "Unable to generate hidden cases", nil)
 			return
 		}
-		for i := range levelInfo.Streams {
-			if levelInfo.Streams[i].Type == emu.IN {
-				levelInfo.Streams[i].Values = runLevel.In[i].Values
+		cases = append(cases, hidden...)
+
+		results := make([]*caseResult, 0, len(cases))
+		for _, tc := range cases {
+			res, err := runCase(r.Context(), cfg, levelInfo, level.Reference, runLevel.Nodes, tc)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, INTERNAL_ERROR, "Unable to get expected values", nil)
+				return
+			}
+			results = append(results, res)
+			if res.Err != nil {
+				break
 			}
 		}
-		out, err := program.Run(levelInfo.Streams, runLevel.Nodes)
-		if err != nil {
-			codeValidation = false
-			status = false
-		}
-		outResp := make([]ioeStreamResponse, 0)
-		if codeValidation {
-			for _, outStream := range out {
-				outResp = append(outResp, ioeStreamResponse{
-					Index:  outStream.Index,
-					Values: outStream.Values,
-				})
+
+		res := results[0]
+		if res.Err != nil && !res.TimedOut {
+			writeCodeError(w, res.Err)
+			return
+		}
+
+		var stats *statsResponse
+		if res.Stats != nil {
+			stats = &statsResponse{
+				Cycles:       res.Stats.Cycles,
+				Nodes:        res.Stats.Nodes,
+				Instructions: res.Stats.Instructions,
 			}
-			status = checkResult(runLevel.Expected, outResp)
+		}
+
+		var deadlock *deadlockResponse
+		if res.Analysis != nil && incomplete(res.Expected, res.Out) {
+			deadlock = newDeadlockResponse(res.Analysis)
+		}
+
+		status := true
+		casesResp := make([]caseResponse, 0, len(results))
+		for i, caseRes := range results {
+			status = status && caseRes.Passed
+			casesResp = append(casesResp, caseResponse{
+				Index:    i,
+				Name:     cases[i].Name,
+				Hidden:   cases[i].Hidden,
+				Passed:   caseRes.Passed,
+				TimedOut: caseRes.TimedOut,
+			})
+		}
+
+		if status && player != "" {
+			tracker.MarkSolved(player, params["level"])
 		}
 
 		json.NewEncoder(w).Encode(RunLevelResponse{
-			CodeValidation: codeValidation,
-			CheckStatus:    status,
-			In:             runLevel.In,
-			Expected:       runLevel.Expected,
-			Out:            outResp,
+			CheckStatus: status,
+			TimedOut:    res.TimedOut,
+			Stats:       stats,
+			Deadlock:    deadlock,
+			Mismatches:  res.Mismatches,
+			Warnings:    res.Warnings,
+			Seed:        runLevel.Seed,
+			Cases:       casesResp,
+			In:          inputStreams(visible.Streams),
+			Expected:    res.Expected,
+			Out:         res.Out,
 		})
 	}
 }
 
-func generateValues(minValue, maxValue int) []int16 {
-	out := make([]int16, 0)
-	for range emu.StreamLength {
-		out = append(out, int16(rand.Intn(maxValue-minValue)+minValue))
+// resolveLevel looks up the level and writes the error response if it is
+// unknown or broken.
+func resolveLevel(w http.ResponseWriter, snapshot *levels.Snapshot, id string) (*levels.Level, bool) {
+	level, err := snapshot.Resolve(id)
+	switch {
+	case errors.Is(err, levels.ErrNotFound):
+		writeError(w, http.StatusNotFound, LEVEL_NOT_FOUND, "Level not found", nil)
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, INTERNAL_ERROR, "Level is broken", nil)
 	}
-	return out
+	return level, err == nil
 }
 
-func checkResult(expected, out []ioeStreamResponse) bool {
-	if len(expected) != len(out) {
-		return false
+func newDeadlockResponse(analysis *program.Analysis) *deadlockResponse {
+	resp := &deadlockResponse{
+		Messages:  make([]string, 0, len(analysis.Waits)),
+		Waits:     make([]waitResponse, 0, len(analysis.Waits)),
+		Deadlocks: make([][]int, 0, len(analysis.Deadlocks)),
 	}
-
-	for i := range expected {
-		if len(expected[i].Values) != len(out[i].Values) {
-			return false
+	for _, wait := range analysis.Waits {
+		resp.Messages = append(resp.Messages, wait.String())
+		resp.Waits = append(resp.Waits, waitResponse(wait))
+	}
+	for _, nodes := range analysis.Deadlocks {
+		cycle := make([]int, 0, len(nodes))
+		for _, index := range nodes {
+			cycle = append(cycle, int(index))
 		}
+		resp.Deadlocks = append(resp.Deadlocks, cycle)
+	}
+	return resp
+}
 
-		for j := range expected[i].Values {
-			if expected[i].Values[j] != out[i].Values[j] {
-				return false
-			}
-		}
+func newLevelEntryResponse(entry levels.Entry) levelEntryResponse {
+	tags := entry.Tags
+	if tags == nil {
+		tags = make([]string, 0)
+	}
+	prerequisites := entry.Prerequisites
+	if prerequisites == nil {
+		prerequisites = make([]string, 0)
 	}
 
-	return true
+	return levelEntryResponse{
+		ID:            entry.ID,
+		Title:         entry.Title,
+		Difficulty:    entry.Difficulty,
+		Tags:          tags,
+		Order:         entry.Order,
+		Prerequisites: prerequisites,
+	}
 }
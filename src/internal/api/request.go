@@ -0,0 +1,174 @@
+package api
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/franchesko/assembly-labyrinth/src/internal/emu"
+	"github.com/franchesko/assembly-labyrinth/src/internal/generator"
+)
+
+// applyInputs fills the input streams with values generated from seed or,
+// without a seed, with the submitted values. It returns the problems with
+// the submitted values.
+func applyInputs(streams []emu.Stream, seed *int64, in []ioeStreamResponse) []string {
+	if seed != nil {
+		generator.Generate(streams, *seed)
+		return nil
+	}
+
+	if problems := validateInputs(streams, in); len(problems) > 0 {
+		return problems
+	}
+	for _, values := range in {
+		for i := range streams {
+			if streams[i].Type == emu.IN && streams[i].Index == values.Index {
+				streams[i].Values = values.Values
+			}
+		}
+	}
+	return nil
+}
+
+// validateInputs checks that in lists every input stream of the level
+// exactly once with a full stream of values its generator can produce. It
+// returns the problems found.
+func validateInputs(streams []emu.Stream, in []ioeStreamResponse) []string {
+	problems := make([]string, 0)
+	inputs := make(map[uint8]emu.Stream)
+	for _, stream := range streams {
+		if stream.Type == emu.IN {
+			inputs[stream.Index] = stream
+		}
+	}
+
+	seen := make(map[uint8]bool)
+	for i, values := range in {
+		stream, ok := inputs[values.Index]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("in %d: stream %d is not an input stream", i, values.Index))
+			continue
+		}
+		if seen[values.Index] {
+			problems = append(problems, fmt.Sprintf("in %d: stream %d is listed twice", i, values.Index))
+			continue
+		}
+		seen[values.Index] = true
+
+		if len(values.Values) != emu.StreamLength {
+			problems = append(problems, fmt.Sprintf("in %d: stream %d must have %d values, got %d", i, values.Index, emu.StreamLength, len(values.Values)))
+		}
+		for j, v := range values.Values {
+			if expected := checkValue(stream, v); expected != "" {
+				problems = append(problems, fmt.Sprintf("in %d: value %d of stream %d is %d, not %s", i, j, values.Index, v, expected))
+				break
+			}
+		}
+		if isSequence(stream) && len(values.Values) > 0 && values.Values[len(values.Values)-1] != 0 {
+			problems = append(problems, fmt.Sprintf("in %d: stream %d must end with 0", i, values.Index))
+		}
+	}
+	if len(problems) == 0 {
+		problems = append(problems, checkDerived(streams, in)...)
+	}
+
+	for _, stream := range streams {
+		if stream.Type == emu.IN && !seen[stream.Index] {
+			problems = append(problems, fmt.Sprintf("stream %d: values are missing", stream.Index))
+		}
+	}
+
+	return problems
+}
+
+// checkValue describes the values the generator of the stream can produce
+// if v is not one of them.
+func checkValue(stream emu.Stream, v int16) string {
+	gen := stream.Generator
+	kind := emu.UNIFORM
+	if gen != nil {
+		kind = gen.Kind
+	}
+
+	switch kind {
+	case emu.CONSTANT:
+		if v != gen.Value {
+			return fmt.Sprintf("%d", gen.Value)
+		}
+	case emu.CHOICE:
+		if !slices.Contains(gen.Values, v) && (len(gen.Values) > 0 || v != 0) {
+			return fmt.Sprintf("one of %v", gen.Values)
+		}
+	case emu.SEQUENCE:
+		if v != 0 && (v < stream.MinValue || v >= stream.MaxValue) {
+			return fmt.Sprintf("0 or in range [%d, %d]", stream.MinValue, stream.MaxValue-1)
+		}
+	case emu.DERIVED:
+		if v < emu.MinACC || v > emu.MaxACC {
+			return fmt.Sprintf("in range [%d, %d]", emu.MinACC, emu.MaxACC)
+		}
+	default:
+		if v < stream.MinValue || v >= stream.MaxValue {
+			return fmt.Sprintf("in range [%d, %d]", stream.MinValue, stream.MaxValue-1)
+		}
+	}
+	return ""
+}
+
+// checkDerived checks that the values of derived streams follow the values
+// submitted for their source streams.
+func checkDerived(streams []emu.Stream, in []ioeStreamResponse) []string {
+	values := make(map[uint8][]int16)
+	for _, stream := range in {
+		values[stream.Index] = stream.Values
+	}
+
+	problems := make([]string, 0)
+	for _, stream := range streams {
+		gen := stream.Generator
+		if stream.Type != emu.IN || gen == nil || gen.Kind != emu.DERIVED {
+			continue
+		}
+		source := values[gen.Source]
+		for j, v := range values[stream.Index] {
+			if j >= len(source) {
+				break
+			}
+			lo, hi := derivedRange(stream, source[j])
+			if v < lo || v > hi {
+				problems = append(problems, fmt.Sprintf("stream %d: value %d is %d, does not follow value %d of stream %d", stream.Index, j, v, source[j], gen.Source))
+				break
+			}
+		}
+	}
+	return problems
+}
+
+// derivedRange returns the inclusive range of values a derived stream can
+// hold for the source value v.
+func derivedRange(stream emu.Stream, v int16) (int16, int16) {
+	gen := stream.Generator
+	switch gen.Derive {
+	case emu.NEGATE:
+		return -v, -v
+	case emu.OFFSET:
+		v = clampACC(int(v) + int(gen.Value))
+		return v, v
+	case emu.JITTER:
+		if stream.MaxValue <= stream.MinValue {
+			v = clampACC(int(v) + int(stream.MinValue))
+			return v, v
+		}
+		return clampACC(int(v) + int(stream.MinValue)), clampACC(int(v) + int(stream.MaxValue) - 1)
+	default:
+		return emu.MinACC, emu.MaxACC
+	}
+}
+
+func isSequence(stream emu.Stream) bool {
+	return stream.Generator != nil && stream.Generator.Kind == emu.SEQUENCE
+}
+
+func clampACC(v int) int16 {
+	return int16(min(max(v, emu.MinACC), emu.MaxACC))
+}
@@ -0,0 +1,184 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/franchesko/assembly-labyrinth/src/internal/config"
+	"github.com/franchesko/assembly-labyrinth/src/internal/emu/program"
+	"github.com/franchesko/assembly-labyrinth/src/internal/levels"
+	"github.com/franchesko/assembly-labyrinth/src/internal/progress"
+	"github.com/gorilla/mux"
+)
+
+// ndjsonType is the content type of traces streamed one cycle per line.
+const ndjsonType = "application/x-ndjson"
+
+type TraceResponse struct {
+	traceSummaryResponse
+	Trace []traceCycleResponse `json:"trace"`
+}
+
+// traceSummaryResponse is how a traced run ended. Streamed traces end with
+// it as their last line, with Error set if the code failed after the first
+// cycles were sent.
+type traceSummaryResponse struct {
+	TimedOut  bool   `json:"timed_out"`
+	Truncated bool   `json:"truncated"`
+	Error     string `json:"error,omitempty"`
+}
+
+type traceCycleResponse struct {
+	Cycle     int                   `json:"cycle"`
+	Nodes     []traceNodeResponse   `json:"nodes,omitempty"`
+	Transfers []transferResponse    `json:"transfers,omitempty"`
+	Outputs   []traceOutputResponse `json:"outputs,omitempty"`
+}
+
+type traceNodeResponse struct {
+	Index   uint8 `json:"index"`
+	Line    int   `json:"line"`
+	Blocked bool  `json:"blocked,omitempty"`
+}
+
+type transferResponse struct {
+	Kind  program.TransferKind `json:"kind"`
+	From  uint8                `json:"from"`
+	To    uint8                `json:"to"`
+	Value int16                `json:"value"`
+}
+
+type traceOutputResponse struct {
+	Stream uint8 `json:"stream"`
+	Value  int16 `json:"value"`
+}
+
+// GetTraceLevelHandler runs the submitted code on the visible inputs and
+// returns the trace of the run. Clients that accept NDJSON get one cycle
+// per line as the program runs, followed by a summary line.
+func GetTraceLevelHandler(cfg *config.Config, cache *levels.Cache, tracker *progress.Tracker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+		w.Header().Set("Content-Type", "application/json")
+		params := mux.Vars(r)
+		level, ok := resolveLevel(w, cache.Snapshot(), params["level"])
+		if !ok {
+			return
+		}
+
+		var runLevel runLevelRequest
+		if err := json.NewDecoder(r.Body).Decode(&runLevel); err != nil {
+			writeError(w, http.StatusBadRequest, MALFORMED_REQUEST, "Wrong request format", err.Error())
+			return
+		}
+
+		levelInfo := level.Info()
+		player := r.Header.Get(progress.PlayerHeader)
+		if tracker.Locked(player, levelInfo.Prerequisites) {
+			writeError(w, http.StatusForbidden, LEVEL_LOCKED, "Level is locked", levelInfo.Prerequisites)
+			return
+		}
+		if problems := applyInputs(levelInfo.Streams, runLevel.Seed, runLevel.In); len(problems) > 0 {
+			writeError(w, http.StatusBadRequest, INVALID_REQUEST, "Wrong input values", problems)
+			return
+		}
+
+		opts := program.Options{
+			MaxCycles:  cfg.MaxCycles,
+			Trace:      true,
+			TraceLimit: cfg.MaxTraceCycles,
+		}
+		var stream *traceStream
+		if strings.Contains(r.Header.Get("Accept"), ndjsonType) {
+			stream = &traceStream{w: w, enc: json.NewEncoder(w)}
+			stream.flusher, _ = w.(http.Flusher)
+			opts.OnTrace = stream.write
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), cfg.RunTimeout)
+		defer cancel()
+		res, err := program.Run(ctx, levelInfo.Layout, levelInfo.Streams, runLevel.Nodes, opts)
+		timedOut := errors.Is(err, program.ErrTimedOut)
+		if err != nil && !timedOut && (stream == nil || !stream.started) {
+			writeCodeError(w, err)
+			return
+		}
+
+		summary := traceSummaryResponse{
+			TimedOut: timedOut,
+		}
+		if res != nil {
+			summary.Truncated = res.TraceTruncated
+		}
+		if stream != nil {
+			if err != nil && !timedOut {
+				summary.Error = err.Error()
+			}
+			stream.end(summary)
+			return
+		}
+
+		trace := make([]traceCycleResponse, 0, len(res.Trace))
+		for _, cycle := range res.Trace {
+			trace = append(trace, newTraceCycleResponse(cycle))
+		}
+		json.NewEncoder(w).Encode(TraceResponse{
+			traceSummaryResponse: summary,
+			Trace:                trace,
+		})
+	}
+}
+
+// traceStream writes the cycles of a traced run as NDJSON while the program
+// runs.
+type traceStream struct {
+	w       http.ResponseWriter
+	enc     *json.Encoder
+	flusher http.Flusher
+	started bool
+	lines   int
+}
+
+func (s *traceStream) write(cycle program.TraceCycle) {
+	s.start()
+	s.enc.Encode(newTraceCycleResponse(cycle))
+	s.lines++
+	if s.flusher != nil && s.lines%100 == 0 {
+		s.flusher.Flush()
+	}
+}
+
+func (s *traceStream) end(summary traceSummaryResponse) {
+	s.start()
+	s.enc.Encode(summary)
+	if s.flusher != nil {
+		s.flusher.Flush()
+	}
+}
+
+func (s *traceStream) start() {
+	if !s.started {
+		s.w.Header().Set("Content-Type", ndjsonType)
+		s.started = true
+	}
+}
+
+func newTraceCycleResponse(cycle program.TraceCycle) traceCycleResponse {
+	resp := traceCycleResponse{
+		Cycle: cycle.Cycle,
+	}
+	for _, n := range cycle.Nodes {
+		resp.Nodes = append(resp.Nodes, traceNodeResponse(n))
+	}
+	for _, t := range cycle.Transfers {
+		resp.Transfers = append(resp.Transfers, transferResponse(t))
+	}
+	for _, out := range cycle.Outputs {
+		resp.Outputs = append(resp.Outputs, traceOutputResponse(out))
+	}
+	return resp
+}
@@ -3,14 +3,30 @@ package config
 import (
 	"log"
 	"os"
+	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
 )
 
 type Config struct {
-	LevelPath  string `yaml:"level_path" env-required:"true"`
-	CodePath   string `yaml:"code_path" env-required:"true"`
-	HTTPServer `yaml:"http_server"`
+	LevelPath      string        `yaml:"level_path" env-required:"true"`
+	CodePath       string        `yaml:"code_path" env-required:"true"`
+	ReloadInterval time.Duration `yaml:"reload_interval" env-default:"2s"`
+	Emulator       `yaml:"emulator"`
+	Debug          `yaml:"debug"`
+	HTTPServer     `yaml:"http_server"`
+}
+
+type Emulator struct {
+	MaxCycles      int           `yaml:"max_cycles" env-default:"100000"`
+	RunTimeout     time.Duration `yaml:"run_timeout" env-default:"2s"`
+	HiddenCases    int           `yaml:"hidden_cases" env-default:"3"`
+	MaxTraceCycles int           `yaml:"max_trace_cycles" env-default:"10000"`
+}
+
+type Debug struct {
+	SessionTTL  time.Duration `yaml:"session_ttl" env-default:"10m"`
+	MaxSessions int           `yaml:"max_sessions" env-default:"100"`
 }
 
 type HTTPServer struct {
@@ -0,0 +1,302 @@
+package debug
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/franchesko/assembly-labyrinth/src/internal/emu"
+	"github.com/franchesko/assembly-labyrinth/src/internal/emu/program"
+)
+
+type StopReason uint8
+
+const (
+	STEPPED StopReason = iota
+	BREAKPOINT
+	HALTED
+	CYCLE_LIMIT
+	TIMED_OUT
+	WATCH
+)
+
+var ErrTooManySessions = errors.New("too many debug sessions")
+
+// Breakpoint stops the program when the node arrives at the instruction on
+// the source line.
+type Breakpoint struct {
+	Node uint8
+	Line int
+}
+
+// Options configure a session. Expected are the output streams of the
+// reference solution that WRONG_OUTPUT watches compare with.
+type Options struct {
+	MaxCycles int
+	Expected  []emu.Stream
+}
+
+// Result is the state of the program after a debug command together with
+// the reason it stopped. Message describes the breakpoint or watch hit.
+type Result struct {
+	State      program.State
+	Stop       StopReason
+	Breakpoint *Breakpoint
+	Watch      *Watch
+	Message    string
+}
+
+// Session is a program that is run cycle by cycle. It is safe for
+// concurrent use.
+type Session struct {
+	ID    string
+	Level string
+
+	mu          sync.Mutex
+	prog        *program.Program
+	breakpoints []Breakpoint
+	watches     []Watch
+	watchStates []watchState
+	expected    map[uint8][]int16
+	maxCycles   int
+}
+
+func (s *Session) State() program.State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.prog.State()
+}
+
+func (s *Session) Conditions() ([]Breakpoint, []Watch) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.breakpoints, s.watches
+}
+
+// SetConditions replaces the breakpoints and watches of the session. Every
+// breakpoint must be on a line with an instruction. Watches whose
+// condition already holds only fire once it becomes true again.
+func (s *Session) SetConditions(breakpoints []Breakpoint, watches []Watch) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, bp := range breakpoints {
+		if err := checkBreakpoint(s.prog, bp); err != nil {
+			return err
+		}
+	}
+	for _, w := range watches {
+		if err := checkWatch(s.prog, s.expected, w); err != nil {
+			return err
+		}
+	}
+
+	s.breakpoints = breakpoints
+	s.watches = watches
+	s.watchStates = make([]watchState, len(watches))
+	for i := range watches {
+		s.watchStates[i].evaluate(s.prog, s.expected, watches[i])
+	}
+	return nil
+}
+
+// Step runs at most cycles cycles and stops early at a breakpoint or when
+// the program halts.
+func (s *Session) Step(ctx context.Context, cycles int) (*Result, error) {
+	return s.run(ctx, max(cycles, 1))
+}
+
+// Continue runs until a breakpoint is hit or the program halts.
+func (s *Session) Continue(ctx context.Context) (*Result, error) {
+	return s.run(ctx, 0)
+}
+
+func (s *Session) run(ctx context.Context, cycles int) (*Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := &Result{
+		Stop: STEPPED,
+	}
+	for i := 0; cycles == 0 || i < cycles; i++ {
+		if s.prog.Halted() {
+			break
+		}
+		if s.maxCycles > 0 && s.prog.Cycle >= s.maxCycles {
+			res.Stop = CYCLE_LIMIT
+			break
+		}
+
+		var before [emu.NodesNumber]int
+		for j, n := range s.prog.Nodes {
+			before[j] = n.Executed
+		}
+		if err := s.prog.Step(ctx); err != nil {
+			if errors.Is(err, program.ErrTimedOut) && ctx.Err() != nil {
+				res.Stop = TIMED_OUT
+				break
+			}
+			return nil, err
+		}
+
+		bp := s.hit(before)
+		w, message := s.watch()
+		if bp != nil {
+			res.Stop = BREAKPOINT
+			res.Breakpoint = bp
+			res.Watch = w
+			res.Message = fmt.Sprintf("node %d reached line %d", bp.Node, bp.Line)
+			if message != "" {
+				res.Message += "; " + message
+			}
+			break
+		}
+		if w != nil {
+			res.Stop = WATCH
+			res.Watch = w
+			res.Message = message
+			break
+		}
+	}
+
+	if res.Stop == STEPPED && s.prog.Halted() {
+		res.Stop = HALTED
+	}
+	res.State = s.prog.State()
+	return res, nil
+}
+
+// hit returns the breakpoint whose node arrived at its line in the last
+// cycle. A node blocked on a breakpoint does not hit it again.
+func (s *Session) hit(before [emu.NodesNumber]int) *Breakpoint {
+	for i := range s.breakpoints {
+		bp := &s.breakpoints[i]
+		arrived := s.prog.Nodes[bp.Node].Executed != before[bp.Node]
+		if arrived && s.prog.Line(bp.Node) == bp.Line {
+			return bp
+		}
+	}
+	return nil
+}
+
+// watch evaluates every watch and returns the first one that fired. All
+// watches are evaluated so none of them misses a change.
+func (s *Session) watch() (*Watch, string) {
+	var fired *Watch
+	var firedMessage string
+	for i := range s.watches {
+		message := s.watchStates[i].evaluate(s.prog, s.expected, s.watches[i])
+		if message != "" && fired == nil {
+			fired = &s.watches[i]
+			firedMessage = message
+		}
+	}
+	return fired, firedMessage
+}
+
+func checkBreakpoint(prog *program.Program, bp Breakpoint) error {
+	if int(bp.Node) >= len(prog.Nodes) {
+		return fmt.Errorf("breakpoint: node %d does not exist", bp.Node)
+	}
+	for _, ins := range prog.Nodes[bp.Node].Instructions {
+		if ins.Line == bp.Line {
+			return nil
+		}
+	}
+	return fmt.Errorf("breakpoint: node %d has no instruction on line %d", bp.Node, bp.Line)
+}
+
+// Store keeps the debug sessions. Sessions that are not used for the TTL
+// are removed.
+type Store struct {
+	mu          sync.Mutex
+	sessions    map[string]*Session
+	lastUsed    map[string]time.Time
+	ttl         time.Duration
+	maxSessions int
+}
+
+func NewStore(ttl time.Duration, maxSessions int) *Store {
+	return &Store{
+		sessions:    make(map[string]*Session),
+		lastUsed:    make(map[string]time.Time),
+		ttl:         ttl,
+		maxSessions: maxSessions,
+	}
+}
+
+// Create starts a session for the program. The session stops the program
+// once it reaches opts.MaxCycles.
+func (s *Store) Create(level string, prog *program.Program, opts Options) (*Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expire(time.Now())
+	if s.maxSessions > 0 && len(s.sessions) >= s.maxSessions {
+		return nil, ErrTooManySessions
+	}
+
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	session := &Session{
+		ID:        id,
+		Level:     level,
+		prog:      prog,
+		expected:  expectedValues(opts.Expected),
+		maxCycles: opts.MaxCycles,
+	}
+	s.sessions[id] = session
+	s.lastUsed[id] = time.Now()
+	return session, nil
+}
+
+func (s *Store) Get(id string) (*Session, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.expire(now)
+	session, ok := s.sessions[id]
+	if ok {
+		s.lastUsed[id] = now
+	}
+	return session, ok
+}
+
+func (s *Store) Delete(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.sessions[id]
+	delete(s.sessions, id)
+	delete(s.lastUsed, id)
+	return ok
+}
+
+func (s *Store) expire(now time.Time) {
+	if s.ttl <= 0 {
+		return
+	}
+	for id, used := range s.lastUsed {
+		if now.Sub(used) > s.ttl {
+			delete(s.sessions, id)
+			delete(s.lastUsed, id)
+		}
+	}
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,154 @@
+package debug
+
+import (
+	"fmt"
+
+	"github.com/franchesko/assembly-labyrinth/src/internal/emu"
+	"github.com/franchesko/assembly-labyrinth/src/internal/emu/program"
+)
+
+type WatchKind uint8
+type Register uint8
+type Comparison uint8
+
+const (
+	REGISTER WatchKind = iota
+	WRONG_OUTPUT
+)
+
+const (
+	ACC Register = iota
+	BAK
+)
+
+const (
+	LT Comparison = iota
+	LE
+	EQ
+	NE
+	GE
+	GT
+)
+
+// Watch stops the program when its condition becomes true:
+//   - REGISTER: Register of Node compared to Value by Comparison;
+//   - WRONG_OUTPUT: output Stream produces a value other than the expected
+//     one, or more values than expected.
+type Watch struct {
+	Kind       WatchKind
+	Node       uint8
+	Register   Register
+	Comparison Comparison
+	Value      int16
+	Stream     uint8
+}
+
+// watchState remembers what a watch saw last, so it only fires when its
+// condition becomes true.
+type watchState struct {
+	active   bool
+	produced int
+}
+
+var registerNames = map[Register]string{
+	ACC: "ACC",
+	BAK: "BAK",
+}
+
+var comparisonNames = map[Comparison]string{
+	LT: "<",
+	LE: "<=",
+	EQ: "=",
+	NE: "!=",
+	GE: ">=",
+	GT: ">",
+}
+
+func (w Watch) String() string {
+	if w.Kind == WRONG_OUTPUT {
+		return fmt.Sprintf("stream %d produced a wrong value", w.Stream)
+	}
+	return fmt.Sprintf("node %d %s %s %d", w.Node, registerNames[w.Register], comparisonNames[w.Comparison], w.Value)
+}
+
+func checkWatch(prog *program.Program, expected map[uint8][]int16, w Watch) error {
+	switch w.Kind {
+	case REGISTER:
+		if int(w.Node) >= len(prog.Nodes) {
+			return fmt.Errorf("watch: node %d does not exist", w.Node)
+		}
+		if _, ok := registerNames[w.Register]; !ok {
+			return fmt.Errorf("watch: unknown register %d", w.Register)
+		}
+		if _, ok := comparisonNames[w.Comparison]; !ok {
+			return fmt.Errorf("watch: unknown comparison %d", w.Comparison)
+		}
+	case WRONG_OUTPUT:
+		if _, ok := expected[w.Stream]; !ok {
+			return fmt.Errorf("watch: stream %d is not an output stream", w.Stream)
+		}
+	default:
+		return fmt.Errorf("watch: unknown kind %d", w.Kind)
+	}
+	return nil
+}
+
+// evaluate checks the condition of the watch and returns a message when
+// it became true since the last evaluation.
+func (ws *watchState) evaluate(prog *program.Program, expected map[uint8][]int16, w Watch) string {
+	switch w.Kind {
+	case REGISTER:
+		n := prog.Nodes[w.Node]
+		value := n.ACC
+		if w.Register == BAK {
+			value = n.BAK
+		}
+		active := compare(value, w.Comparison, w.Value)
+		fired := active && !ws.active
+		ws.active = active
+		if fired {
+			return fmt.Sprintf("node %d %s is %d", w.Node, registerNames[w.Register], value)
+		}
+	case WRONG_OUTPUT:
+		values := prog.Output.Values(w.Stream)
+		want := expected[w.Stream]
+		for i := ws.produced; i < len(values); i++ {
+			ws.produced = i + 1
+			if i >= len(want) {
+				return fmt.Sprintf("stream %d produced more than the %d expected values", w.Stream, len(want))
+			}
+			if values[i] != want[i] {
+				return fmt.Sprintf("stream %d value %d is %d, expected %d", w.Stream, i, values[i], want[i])
+			}
+		}
+	}
+	return ""
+}
+
+func compare(a int16, cmp Comparison, b int16) bool {
+	switch cmp {
+	case LT:
+		return a < b
+	case LE:
+		return a <= b
+	case EQ:
+		return a == b
+	case NE:
+		return a != b
+	case GE:
+		return a >= b
+	case GT:
+		return a > b
+	}
+	return false
+}
+
+func expectedValues(streams []emu.Stream) map[uint8][]int16 {
+	expected := make(map[uint8][]int16)
+	for _, stream := range streams {
+		if stream.Type == emu.OUT {
+			expected[stream.Index] = stream.Values
+		}
+	}
+	return expected
+}
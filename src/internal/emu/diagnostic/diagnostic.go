@@ -0,0 +1,63 @@
+package diagnostic
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type Severity uint8
+
+const (
+	ERROR Severity = iota
+	WARNING
+)
+
+// Diagnostic describes a problem found in the source code of a node.
+// Line and columns are 1-based, ColumnEnd points just past the last
+// character of the reported range.
+type Diagnostic struct {
+	Node        uint8    `json:"node"`
+	Line        int      `json:"line"`
+	ColumnStart int      `json:"column_start"`
+	ColumnEnd   int      `json:"column_end"`
+	Severity    Severity `json:"severity"`
+	Message     string   `json:"message"`
+}
+
+// List collects the diagnostics of all nodes of a program. It implements
+// error so it can be returned from code loading as is.
+type List []Diagnostic
+
+func (d Diagnostic) Error() string {
+	return fmt.Sprintf("node %d, line %d, column %d: %s", d.Node, d.Line, d.ColumnStart, d.Message)
+}
+
+func (l List) Error() string {
+	messages := make([]string, 0, len(l))
+	for _, d := range l {
+		messages = append(messages, d.Error())
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (l List) HasErrors() bool {
+	for _, d := range l {
+		if d.Severity == ERROR {
+			return true
+		}
+	}
+	return false
+}
+
+func (l List) Sort() {
+	sort.SliceStable(l, func(i, j int) bool {
+		if l[i].Node != l[j].Node {
+			return l[i].Node < l[j].Node
+		}
+		if l[i].Line != l[j].Line {
+			return l[i].Line < l[j].Line
+		}
+		return l[i].ColumnStart < l[j].ColumnStart
+	})
+}
@@ -2,16 +2,15 @@ package node
 
 import (
 	"errors"
-	"strconv"
-	"strings"
 
 	"github.com/franchesko/assembly-labyrinth/src/internal/emu"
-	"github.com/franchesko/assembly-labyrinth/src/internal/emu/inputcode"
+	"github.com/franchesko/assembly-labyrinth/src/internal/emu/parser"
 )
 
 type Node struct {
 	Index          uint8
 	Visible        bool
+	Damaged        bool
 	Blocked        bool
 	CursorPosition uint8
 	Instructions   []*emu.Instruction
@@ -21,6 +20,27 @@ type Node struct {
 	Last           *Node
 	OutputValue    int16
 	Ports          [4]*Node
+	Output         *emu.Output
+	Executed       int
+	Recorder       *Recorder
+}
+
+// Recorder collects the values nodes read from each other and the values
+// they write to output streams while a program is traced.
+type Recorder struct {
+	Transfers []Transfer
+	Results   []Result
+}
+
+type Transfer struct {
+	From  *Node
+	To    *Node
+	Value int16
+}
+
+type Result struct {
+	Node  *Node
+	Value int16
 }
 
 type readResult struct {
@@ -31,6 +51,7 @@ type readResult struct {
 func NewNode() *Node {
 	return &Node{
 		Visible:        false,
+		Damaged:        false,
 		Blocked:        false,
 		CursorPosition: 0,
 		Instructions:   make([]*emu.Instruction, 0),
@@ -40,6 +61,7 @@ func NewNode() *Node {
 		Last:           nil,
 		OutputValue:    0,
 		Ports:          [4]*Node{nil, nil, nil, nil},
+		Output:         nil,
 	}
 }
 
@@ -52,89 +74,25 @@ func (n *Node) CreateInstruction(op emu.Operation) *emu.Instruction {
 	return ins
 }
 
-func (n *Node) ParseCode(ic *inputcode.InputCode) error {
-	for i, line := range ic.Lines {
-		if ind := strings.Index(line, ":"); ind != -1 {
-			label := line[:ind]
-			ic.Labels[label] = uint8(i)
-
-			rem := strings.TrimSpace(line[ind+1:])
-			if len(rem) == 0 {
-				rem = "NOP"
-			}
-			ic.Lines[i] = rem
-		}
-	}
-
-	var err error
-	for _, line := range ic.Lines {
-		if err = n.ParseLine(ic, line); err != nil {
-			return err
+// Assemble generates the instructions of the node from a parsed program
+// that has no errors.
+func (n *Node) Assemble(prog *parser.Program) {
+	for _, stmt := range prog.Statements {
+		if stmt.Instruction == nil {
+			n.CreateInstruction(emu.NOP).Line = stmt.Line
+			continue
 		}
-	}
-
-	return nil
-}
 
-func (n *Node) ParseLine(ic *inputcode.InputCode, line string) error {
-	if len(line) <= 2 {
-		return errors.New("invalid line length")
-	}
-
-	strIns := line[:3]
-	var err error
-	switch strIns {
-	case "MOV":
-		if err = n.parseMov(line); err != nil {
-			return err
+		ins := n.CreateInstruction(stmt.Instruction.Operation)
+		ins.Line = stmt.Line
+		operands := stmt.Instruction.Operands
+		if len(operands) > 0 {
+			setLocation(operands[0], &ins.SrcType, &ins.Src)
 		}
-	case "SUB":
-		if err = n.parseOneArg(ic, line, emu.SUB); err != nil {
-			return err
-		}
-	case "ADD":
-		if err = n.parseOneArg(ic, line, emu.ADD); err != nil {
-			return err
+		if len(operands) > 1 {
+			setLocation(operands[1], &ins.DestType, &ins.Dest)
 		}
-	case "JEZ":
-		if err = n.parseOneArg(ic, line, emu.JEZ); err != nil {
-			return err
-		}
-	case "JMP":
-		if err = n.parseOneArg(ic, line, emu.JMP); err != nil {
-			return err
-		}
-	case "JNZ":
-		if err = n.parseOneArg(ic, line, emu.JNZ); err != nil {
-			return err
-		}
-	case "JGZ":
-		if err = n.parseOneArg(ic, line, emu.JGZ); err != nil {
-			return err
-		}
-	case "JLZ":
-		if err = n.parseOneArg(ic, line, emu.JLZ); err != nil {
-			return err
-		}
-	case "JRO":
-		if err = n.parseOneArg(ic, line, emu.JRO); err != nil {
-			return err
-		}
-	case "SAV":
-		n.CreateInstruction(emu.SAV)
-	case "SWP":
-		n.CreateInstruction(emu.SWP)
-	case "NOP":
-		n.CreateInstruction(emu.NOP)
-	case "NEG":
-		n.CreateInstruction(emu.NEG)
-	case "RES":
-		n.CreateInstruction(emu.RES)
-	default:
-		return errors.New("invalid instruction")
 	}
-
-	return nil
 }
 
 func (n *Node) Read(locType emu.LocationType, loc emu.Location) (readResult, error) {
@@ -159,6 +117,13 @@ func (n *Node) Read(locType emu.LocationType, loc emu.Location) (readResult, err
 			if readFrom != nil && readFrom.OutputPort == n {
 				res.Value = readFrom.OutputValue
 				res.Blocked = false
+				if n.Recorder != nil {
+					n.Recorder.Transfers = append(n.Recorder.Transfers, Transfer{
+						From:  readFrom,
+						To:    n,
+						Value: res.Value,
+					})
+				}
 
 				readFrom.OutputValue = 0
 				readFrom.OutputPort = nil
@@ -195,7 +160,7 @@ func (n *Node) Write(dir emu.LocationDirection, value int16) (bool, error) {
 		}
 		return true, nil
 	case emu.NIL:
-		return false, errors.New("unable to write")
+		return false, nil
 	default:
 		return false, errors.New("nowhere to write")
 	}
@@ -205,6 +170,7 @@ func (n *Node) Write(dir emu.LocationDirection, value int16) (bool, error) {
 
 func (n *Node) MoveCursor() {
 	n.CursorPosition += 1
+	n.Executed++
 }
 
 func (n *Node) Tick() error {
@@ -257,7 +223,15 @@ func (n *Node) Tick() error {
 		n.setCursorPosition(ins.Src.Number)
 		return nil
 	case emu.JRO:
-		n.setCursorPosition(int16(n.CursorPosition) + ins.Src.Number)
+		read, err := n.Read(ins.SrcType, ins.Src)
+		if err != nil {
+			return err
+		}
+		if read.Blocked {
+			return nil
+		}
+
+		n.setCursorPosition(int16(n.CursorPosition) + read.Value)
 		return nil
 	case emu.JEZ:
 		if n.ACC == 0 {
@@ -288,7 +262,16 @@ func (n *Node) Tick() error {
 		n.ACC = -1 * n.ACC
 	case emu.NOP:
 	case emu.RES:
-		emu.AddOutputValue(n.Index, n.ACC)
+		if n.Output == nil {
+			return errors.New("no output to write result")
+		}
+		n.Output.AddOutputValue(n.Index, n.ACC)
+		if n.Recorder != nil {
+			n.Recorder.Results = append(n.Recorder.Results, Result{
+				Node:  n,
+				Value: n.ACC,
+			})
+		}
 	default:
 		return errors.New("unknown operation")
 	}
@@ -298,64 +281,12 @@ func (n *Node) Tick() error {
 	return nil
 }
 
-func (n *Node) parseMov(line string) error {
-	if len(line) <= 3 {
-		return errors.New("wrong mov instruction format")
-	}
-	rem := line[4:]
-	var tokens []string
-	if strings.Contains(rem, ", ") {
-		tokens = strings.Split(rem, ", ")
-	} else if strings.Contains(rem, ",") {
-		tokens = strings.Split(rem, ",")
-	} else {
-		tokens = strings.Split(rem, " ")
-	}
-	if len(tokens) != 2 {
-		return errors.New("wrong mov instruction format")
-	}
-
-	ins := n.CreateInstruction(emu.MOV)
-	var err error
-	if err = parseLocation(tokens[0], &ins.SrcType, &ins.Src); err != nil {
-		return err
-	}
-	if err = parseLocation(tokens[1], &ins.DestType, &ins.Dest); err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func (n *Node) parseOneArg(ic *inputcode.InputCode, line string, op emu.Operation) error {
-	if len(line) <= 3 {
-		return errors.New("wrong one arg instruction format")
-	}
-	rem := line[4:]
-	ins := n.CreateInstruction(op)
-
-	switch op {
-	case emu.JEZ, emu.JMP, emu.JNZ, emu.JGZ, emu.JLZ:
-		for label, pos := range ic.Labels {
-			if rem == label {
-				ins.SrcType = emu.NUMBER
-				ins.Src.Number = int16(pos)
-			}
-		}
-	default:
-		if err := parseLocation(rem, &ins.SrcType, &ins.Src); err != nil {
-			return err
-		}
-	}
-
-	return nil
-}
-
 func (n *Node) setCursorPosition(pos int16) {
 	if pos >= int16(len(n.Instructions)) || pos < 0 {
 		pos = 0
 	}
 	n.CursorPosition = uint8(pos)
+	n.Executed++
 }
 
 func (n *Node) getInputPort(dir emu.LocationDirection) *Node {
@@ -381,8 +312,8 @@ func (n *Node) getOutputPort(dir emu.LocationDirection) *Node {
 		for _, d := range dirs {
 			port := n.Ports[d]
 			if port != nil {
-				ins := port.Instructions[port.CursorPosition]
-				if ins.Operation == emu.MOV && ins.SrcType == emu.ADDRESS && (ins.Src.Direction == emu.ANY || port.Ports[ins.Src.Direction] == n) {
+				ins := port.nextInstruction()
+				if ins != nil && ins.Operation == emu.MOV && ins.SrcType == emu.ADDRESS && (ins.Src.Direction == emu.ANY || port.Ports[ins.Src.Direction] == n) {
 					return port
 				}
 			}
@@ -395,6 +326,18 @@ func (n *Node) getOutputPort(dir emu.LocationDirection) *Node {
 	}
 }
 
+// nextInstruction returns the instruction the node executes in its next
+// tick, or nil if it has no code.
+func (n *Node) nextInstruction() *emu.Instruction {
+	if len(n.Instructions) == 0 {
+		return nil
+	}
+	if n.CursorPosition >= uint8(len(n.Instructions)) {
+		return n.Instructions[0]
+	}
+	return n.Instructions[n.CursorPosition]
+}
+
 func (n *Node) normalizeACC() {
 	if n.ACC > emu.MaxACC {
 		n.ACC = emu.MaxACC
@@ -404,38 +347,16 @@ func (n *Node) normalizeACC() {
 	}
 }
 
-func parseLocation(strLoc string, locType *emu.LocationType, loc *emu.Location) error {
-	if strLoc == "" {
-		return errors.New("no source was found")
-	}
-
-	*locType = emu.ADDRESS
-	switch strLoc {
-	case "UP":
-		loc.Direction = emu.UP
-	case "DOWN":
-		loc.Direction = emu.DOWN
-	case "LEFT":
-		loc.Direction = emu.LEFT
-	case "RIGHT":
-		loc.Direction = emu.RIGHT
-	case "ACC":
-		loc.Direction = emu.ACC
-	case "NIL":
-		loc.Direction = emu.NIL
-	case "ANY":
-		loc.Direction = emu.ANY
-	case "LAST":
-		loc.Direction = emu.LAST
-	default:
-		num, err := strconv.Atoi(strLoc)
-		if err != nil {
-			return err
-		}
-
+func setLocation(operand *parser.Operand, locType *emu.LocationType, loc *emu.Location) {
+	switch operand.Kind {
+	case parser.LITERAL:
+		*locType = emu.NUMBER
+		loc.Number = operand.Number
+	case parser.LABEL:
 		*locType = emu.NUMBER
-		loc.Number = int16(num)
+		loc.Number = int16(operand.Target)
+	case parser.REGISTER:
+		*locType = emu.ADDRESS
+		loc.Direction = operand.Direction
 	}
-
-	return nil
 }
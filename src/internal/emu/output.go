@@ -1,6 +1,19 @@
 package emu
 
-var output []Stream = make([]Stream, 0)
+// Output collects the values written to the output streams together with
+// the cycle each value was written in.
+type Output struct {
+	streams []Stream
+	cycles  [][]int
+	cycle   int
+}
+
+func NewOutput() *Output {
+	return &Output{
+		streams: make([]Stream, 0),
+		cycles:  make([][]int, 0),
+	}
+}
 
 func NewOutputStream(index uint8) Stream {
 	return Stream{
@@ -10,24 +23,49 @@ func NewOutputStream(index uint8) Stream {
 	}
 }
 
-func AddOutputStream(stream Stream) {
-	output = append(output, stream)
+func (o *Output) AddOutputStream(stream Stream) {
+	o.streams = append(o.streams, stream)
+	o.cycles = append(o.cycles, make([]int, 0))
+}
+
+// SetCycle sets the cycle the values written from now on are written in.
+func (o *Output) SetCycle(cycle int) {
+	o.cycle = cycle
 }
 
-func AddOutputValue(index uint8, value int16) bool {
-	for i := range output {
-		if output[i].Index == index {
-			output[i].Values = append(output[i].Values, value)
+func (o *Output) AddOutputValue(index uint8, value int16) bool {
+	for i := range o.streams {
+		if o.streams[i].Index == index {
+			o.streams[i].Values = append(o.streams[i].Values, value)
+			o.cycles[i] = append(o.cycles[i], o.cycle)
 			return true
 		}
 	}
 	return false
 }
 
-func GetOutput() []Stream {
-	return output
+func (o *Output) GetOutput() []Stream {
+	return o.streams
 }
 
-func ClearOutput() {
-	output = make([]Stream, 0)
+// GetCycles returns the cycles the values of every output stream were
+// written in, by stream index.
+func (o *Output) GetCycles() map[uint8][]int {
+	cycles := make(map[uint8][]int, len(o.streams))
+	for i, stream := range o.streams {
+		cycles[stream.Index] = o.cycles[i]
+	}
+	return cycles
+}
+
+// Values returns a copy of the values written to the output stream so far.
+func (o *Output) Values(index uint8) []int16 {
+	for _, stream := range o.streams {
+		if stream.Index == index {
+			values := make([]int16, len(stream.Values))
+			copy(values, stream.Values)
+			return values
+		}
+	}
+	return nil
 }
@@ -0,0 +1,48 @@
+package parser
+
+import "github.com/franchesko/assembly-labyrinth/src/internal/emu"
+
+type OperandKind uint8
+
+const (
+	LITERAL OperandKind = iota
+	REGISTER
+	LABEL
+)
+
+// Program is the AST of the source code of a single node. Every statement
+// becomes exactly one instruction, a statement without an instruction is
+// executed as NOP.
+type Program struct {
+	Statements []*Statement
+}
+
+type Statement struct {
+	Line        int
+	Labels      []*Label
+	Instruction *Instruction
+}
+
+type Label struct {
+	Name   string
+	Column int
+	End    int
+}
+
+type Instruction struct {
+	Operation emu.Operation
+	Name      string
+	Operands  []*Operand
+	Column    int
+	End       int
+}
+
+type Operand struct {
+	Kind      OperandKind
+	Text      string
+	Number    int16
+	Direction emu.LocationDirection
+	Target    uint8
+	Column    int
+	End       int
+}
@@ -0,0 +1,98 @@
+package parser
+
+import (
+	"strings"
+	"unicode"
+)
+
+const CommentPrefix = '#'
+
+type TokenKind uint8
+
+const (
+	IDENT TokenKind = iota
+	NUMBER
+	COLON
+	COMMA
+	ILLEGAL
+)
+
+// Token is a lexeme of a single source line. Columns are 1-based and End
+// points just past the last character of the token.
+type Token struct {
+	Kind   TokenKind
+	Text   string
+	Column int
+	End    int
+}
+
+// Tokenize splits a source line into tokens. Identifiers are upper-cased,
+// everything after CommentPrefix is dropped.
+func Tokenize(line string) []Token {
+	tokens := make([]Token, 0)
+	for i := 0; i < len(line); {
+		c := line[i]
+		switch {
+		case c == CommentPrefix:
+			return tokens
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case c == ':':
+			tokens = append(tokens, Token{Kind: COLON, Text: ":", Column: i + 1, End: i + 2})
+			i++
+		case c == ',':
+			tokens = append(tokens, Token{Kind: COMMA, Text: ",", Column: i + 1, End: i + 2})
+			i++
+		default:
+			start := i
+			for i < len(line) && !isSeparator(line[i]) {
+				i++
+			}
+			word := line[start:i]
+			tokens = append(tokens, Token{Kind: classify(word), Text: strings.ToUpper(word), Column: start + 1, End: i + 1})
+		}
+	}
+	return tokens
+}
+
+func isSeparator(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == ':' || c == ',' || c == CommentPrefix
+}
+
+func classify(word string) TokenKind {
+	if isNumber(word) {
+		return NUMBER
+	}
+	if isIdent(word) {
+		return IDENT
+	}
+	return ILLEGAL
+}
+
+func isNumber(word string) bool {
+	if word[0] == '-' || word[0] == '+' {
+		word = word[1:]
+	}
+	if word == "" {
+		return false
+	}
+	for _, r := range word {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isIdent(word string) bool {
+	for i, r := range word {
+		if r == '_' || (r < unicode.MaxASCII && unicode.IsLetter(r)) {
+			continue
+		}
+		if i > 0 && r >= '0' && r <= '9' {
+			continue
+		}
+		return false
+	}
+	return true
+}
@@ -0,0 +1,282 @@
+package parser
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/franchesko/assembly-labyrinth/src/internal/emu"
+	"github.com/franchesko/assembly-labyrinth/src/internal/emu/diagnostic"
+)
+
+type operandRole uint8
+
+const (
+	source operandRole = iota
+	destination
+	target
+)
+
+type opcode struct {
+	operation emu.Operation
+	operands  []operandRole
+}
+
+var opcodes = map[string]opcode{
+	"MOV": {emu.MOV, []operandRole{source, destination}},
+	"SAV": {emu.SAV, nil},
+	"SWP": {emu.SWP, nil},
+	"SUB": {emu.SUB, []operandRole{source}},
+	"ADD": {emu.ADD, []operandRole{source}},
+	"NOP": {emu.NOP, nil},
+	"NEG": {emu.NEG, nil},
+	"JEZ": {emu.JEZ, []operandRole{target}},
+	"JMP": {emu.JMP, []operandRole{target}},
+	"JNZ": {emu.JNZ, []operandRole{target}},
+	"JGZ": {emu.JGZ, []operandRole{target}},
+	"JLZ": {emu.JLZ, []operandRole{target}},
+	"JRO": {emu.JRO, []operandRole{source}},
+}
+
+var registers = map[string]emu.LocationDirection{
+	"UP":    emu.UP,
+	"RIGHT": emu.RIGHT,
+	"DOWN":  emu.DOWN,
+	"LEFT":  emu.LEFT,
+	"NIL":   emu.NIL,
+	"ACC":   emu.ACC,
+	"ANY":   emu.ANY,
+	"LAST":  emu.LAST,
+}
+
+type parser struct {
+	node  uint8
+	line  int
+	diags diagnostic.List
+}
+
+// Parse builds the AST of the source code of the node with the given
+// index. Problems are reported as diagnostics, the returned program is
+// only complete when none of them is an error.
+func Parse(node uint8, lines []string) (*Program, diagnostic.List) {
+	p := &parser{
+		node:  node,
+		diags: make(diagnostic.List, 0),
+	}
+	prog := &Program{
+		Statements: make([]*Statement, 0),
+	}
+
+	for i, line := range lines {
+		p.line = i + 1
+		stmt := p.parseLine(Tokenize(line))
+		if stmt == nil {
+			continue
+		}
+		if len(prog.Statements) == math.MaxUint8 {
+			p.errorf(1, len(line)+1, "too many instructions, at most %d are allowed", math.MaxUint8)
+			break
+		}
+		prog.Statements = append(prog.Statements, stmt)
+	}
+	p.resolveLabels(prog)
+
+	return prog, p.diags
+}
+
+func (p *parser) parseLine(tokens []Token) *Statement {
+	stmt := &Statement{
+		Line:   p.line,
+		Labels: make([]*Label, 0),
+	}
+
+	i := 0
+	for i+1 < len(tokens) && tokens[i].Kind == IDENT && tokens[i+1].Kind == COLON {
+		stmt.Labels = append(stmt.Labels, &Label{
+			Name:   tokens[i].Text,
+			Column: tokens[i].Column,
+			End:    tokens[i].End,
+		})
+		i += 2
+	}
+
+	if i == len(tokens) && len(stmt.Labels) == 0 {
+		return nil
+	}
+	if i < len(tokens) {
+		stmt.Instruction = p.parseInstruction(tokens[i:])
+	}
+	return stmt
+}
+
+func (p *parser) parseInstruction(tokens []Token) *Instruction {
+	name := tokens[0]
+	if name.Kind != IDENT {
+		p.errorf(name.Column, name.End, "expected instruction, found %q", name.Text)
+		return nil
+	}
+	op, ok := opcodes[name.Text]
+	if !ok {
+		p.errorf(name.Column, name.End, "invalid instruction %q", name.Text)
+		return nil
+	}
+
+	ins := &Instruction{
+		Operation: op.operation,
+		Name:      name.Text,
+		Operands:  make([]*Operand, 0, len(op.operands)),
+		Column:    name.Column,
+		End:       tokens[len(tokens)-1].End,
+	}
+
+	args := make([]Token, 0, len(tokens)-1)
+	for i, tok := range tokens[1:] {
+		switch tok.Kind {
+		case COMMA:
+			if i == 0 || i == len(tokens)-2 || tokens[i].Kind == COMMA {
+				p.errorf(tok.Column, tok.End, "unexpected %q", tok.Text)
+				return nil
+			}
+		case COLON:
+			p.errorf(tok.Column, tok.End, "unexpected %q", tok.Text)
+			return nil
+		default:
+			args = append(args, tok)
+		}
+	}
+
+	if len(args) != len(op.operands) {
+		p.errorf(ins.Column, ins.End, "%s expects %d operand(s), found %d", ins.Name, len(op.operands), len(args))
+		return nil
+	}
+
+	valid := true
+	for i, arg := range args {
+		operand := p.parseOperand(arg, op.operands[i])
+		if operand == nil {
+			valid = false
+			continue
+		}
+		ins.Operands = append(ins.Operands, operand)
+	}
+	if !valid {
+		return nil
+	}
+
+	return ins
+}
+
+func (p *parser) parseOperand(tok Token, role operandRole) *Operand {
+	operand := &Operand{
+		Text:   tok.Text,
+		Column: tok.Column,
+		End:    tok.End,
+	}
+
+	switch role {
+	case target:
+		if tok.Kind != IDENT {
+			p.errorf(tok.Column, tok.End, "expected label, found %q", tok.Text)
+			return nil
+		}
+		operand.Kind = LABEL
+		return operand
+	case source:
+		if tok.Kind == NUMBER {
+			num, err := strconv.Atoi(tok.Text)
+			if err != nil || num < emu.MinACC || num > emu.MaxACC {
+				p.errorf(tok.Column, tok.End, "value %s is out of range [%d, %d]", tok.Text, emu.MinACC, emu.MaxACC)
+				return nil
+			}
+			operand.Kind = LITERAL
+			operand.Number = int16(num)
+			return operand
+		}
+	case destination:
+		if tok.Kind == NUMBER {
+			p.errorf(tok.Column, tok.End, "cannot write to a literal value")
+			return nil
+		}
+	}
+
+	dir, ok := registers[tok.Text]
+	if tok.Kind != IDENT || !ok {
+		p.errorf(tok.Column, tok.End, "invalid operand %q", tok.Text)
+		return nil
+	}
+	operand.Kind = REGISTER
+	operand.Direction = dir
+	return operand
+}
+
+func (p *parser) resolveLabels(prog *Program) {
+	positions := make(map[string]uint8)
+	lines := make(map[string]int)
+	for i, stmt := range prog.Statements {
+		p.line = stmt.Line
+		for _, label := range stmt.Labels {
+			if _, ok := registers[label.Name]; ok {
+				p.errorf(label.Column, label.End, "label %q shadows a register name", label.Name)
+				continue
+			}
+			if _, ok := opcodes[label.Name]; ok {
+				p.errorf(label.Column, label.End, "label %q shadows an instruction name", label.Name)
+				continue
+			}
+			if line, ok := lines[label.Name]; ok {
+				p.errorf(label.Column, label.End, "label %q is already defined on line %d", label.Name, line)
+				continue
+			}
+			positions[label.Name] = uint8(i)
+			lines[label.Name] = stmt.Line
+		}
+	}
+
+	used := make(map[string]bool)
+	for _, stmt := range prog.Statements {
+		if stmt.Instruction == nil {
+			continue
+		}
+		p.line = stmt.Line
+		for _, operand := range stmt.Instruction.Operands {
+			if operand.Kind != LABEL {
+				continue
+			}
+			pos, ok := positions[operand.Text]
+			if !ok {
+				p.errorf(operand.Column, operand.End, "undefined label %q", operand.Text)
+				continue
+			}
+			operand.Target = pos
+			used[operand.Text] = true
+		}
+	}
+
+	for _, stmt := range prog.Statements {
+		p.line = stmt.Line
+		for _, label := range stmt.Labels {
+			if _, ok := positions[label.Name]; ok && !used[label.Name] && lines[label.Name] == stmt.Line {
+				p.warnf(label.Column, label.End, "label %q is never used", label.Name)
+			}
+		}
+	}
+}
+
+func (p *parser) errorf(column, end int, format string, args ...any) {
+	p.report(diagnostic.ERROR, column, end, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) warnf(column, end int, format string, args ...any) {
+	p.report(diagnostic.WARNING, column, end, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) report(severity diagnostic.Severity, column, end int, msg string) {
+	p.diags = append(p.diags, diagnostic.Diagnostic{
+		Node:        p.node,
+		Line:        p.line,
+		ColumnStart: column,
+		ColumnEnd:   end,
+		Severity:    severity,
+		Message:     msg,
+	})
+}
@@ -0,0 +1,305 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/franchesko/assembly-labyrinth/src/internal/emu"
+	"github.com/franchesko/assembly-labyrinth/src/internal/emu/diagnostic"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want []Token
+	}{
+		{
+			name: "empty",
+			line: "",
+			want: []Token{},
+		},
+		{
+			name: "instruction",
+			line: "mov up, acc",
+			want: []Token{
+				{Kind: IDENT, Text: "MOV", Column: 1, End: 4},
+				{Kind: IDENT, Text: "UP", Column: 5, End: 7},
+				{Kind: COMMA, Text: ",", Column: 7, End: 8},
+				{Kind: IDENT, Text: "ACC", Column: 9, End: 12},
+			},
+		},
+		{
+			name: "label and number",
+			line: "\tL1:ADD -5",
+			want: []Token{
+				{Kind: IDENT, Text: "L1", Column: 2, End: 4},
+				{Kind: COLON, Text: ":", Column: 4, End: 5},
+				{Kind: IDENT, Text: "ADD", Column: 5, End: 8},
+				{Kind: NUMBER, Text: "-5", Column: 9, End: 11},
+			},
+		},
+		{
+			name: "comment",
+			line: "NOP # MOV UP DOWN",
+			want: []Token{
+				{Kind: IDENT, Text: "NOP", Column: 1, End: 4},
+			},
+		},
+		{
+			name: "comment without space",
+			line: "SWP#SAV",
+			want: []Token{
+				{Kind: IDENT, Text: "SWP", Column: 1, End: 4},
+			},
+		},
+		{
+			name: "illegal",
+			line: "ADD 1A",
+			want: []Token{
+				{Kind: IDENT, Text: "ADD", Column: 1, End: 4},
+				{Kind: ILLEGAL, Text: "1A", Column: 5, End: 7},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Tokenize(tt.line); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Tokenize(%q) = %+v, want %+v", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseInstructions(t *testing.T) {
+	tests := []struct {
+		name string
+		src  []string
+		want []Instruction
+	}{
+		{
+			name: "comma forms",
+			src:  []string{"MOV UP DOWN", "MOV UP, DOWN", "MOV UP,DOWN"},
+			want: []Instruction{
+				{Operation: emu.MOV, Name: "MOV", Operands: []*Operand{
+					{Kind: REGISTER, Text: "UP", Direction: emu.UP, Column: 5, End: 7},
+					{Kind: REGISTER, Text: "DOWN", Direction: emu.DOWN, Column: 8, End: 12},
+				}, Column: 1, End: 12},
+				{Operation: emu.MOV, Name: "MOV", Operands: []*Operand{
+					{Kind: REGISTER, Text: "UP", Direction: emu.UP, Column: 5, End: 7},
+					{Kind: REGISTER, Text: "DOWN", Direction: emu.DOWN, Column: 9, End: 13},
+				}, Column: 1, End: 13},
+				{Operation: emu.MOV, Name: "MOV", Operands: []*Operand{
+					{Kind: REGISTER, Text: "UP", Direction: emu.UP, Column: 5, End: 7},
+					{Kind: REGISTER, Text: "DOWN", Direction: emu.DOWN, Column: 8, End: 12},
+				}, Column: 1, End: 12},
+			},
+		},
+		{
+			name: "comments and blank lines",
+			src:  []string{"# header", "", "   ", "add 1 # one", "NEG#"},
+			want: []Instruction{
+				{Operation: emu.ADD, Name: "ADD", Operands: []*Operand{
+					{Kind: LITERAL, Text: "1", Number: 1, Column: 5, End: 6},
+				}, Column: 1, End: 6},
+				{Operation: emu.NEG, Name: "NEG", Operands: []*Operand{}, Column: 1, End: 4},
+			},
+		},
+		{
+			name: "register source of JRO",
+			src:  []string{"JRO ACC"},
+			want: []Instruction{
+				{Operation: emu.JRO, Name: "JRO", Operands: []*Operand{
+					{Kind: REGISTER, Text: "ACC", Direction: emu.ACC, Column: 5, End: 8},
+				}, Column: 1, End: 8},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prog, diags := Parse(0, tt.src)
+			if len(diags) > 0 {
+				t.Fatalf("unexpected diagnostics: %v", diags)
+			}
+			got := make([]Instruction, 0, len(prog.Statements))
+			for _, stmt := range prog.Statements {
+				got = append(got, *stmt.Instruction)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Parse(%q) = %+v, want %+v", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseDiagnostics(t *testing.T) {
+	tests := []struct {
+		name string
+		src  []string
+		want diagnostic.List
+	}{
+		{
+			name: "unknown instruction",
+			src:  []string{"NOP", "FOO UP"},
+			want: diagnostic.List{
+				{Line: 2, ColumnStart: 1, ColumnEnd: 4, Message: `invalid instruction "FOO"`},
+			},
+		},
+		{
+			name: "operand count",
+			src:  []string{"ADD 1 2"},
+			want: diagnostic.List{
+				{Line: 1, ColumnStart: 1, ColumnEnd: 8, Message: "ADD expects 1 operand(s), found 2"},
+			},
+		},
+		{
+			name: "invalid operand",
+			src:  []string{"MOV UP SIDEWAYS"},
+			want: diagnostic.List{
+				{Line: 1, ColumnStart: 8, ColumnEnd: 16, Message: `invalid operand "SIDEWAYS"`},
+			},
+		},
+		{
+			name: "literal destination",
+			src:  []string{"MOV UP 1"},
+			want: diagnostic.List{
+				{Line: 1, ColumnStart: 8, ColumnEnd: 9, Message: "cannot write to a literal value"},
+			},
+		},
+		{
+			name: "value out of range",
+			src:  []string{"ADD 1000"},
+			want: diagnostic.List{
+				{Line: 1, ColumnStart: 5, ColumnEnd: 9, Message: "value 1000 is out of range [-999, 999]"},
+			},
+		},
+		{
+			name: "stray commas",
+			src:  []string{"MOV, UP DOWN", "MOV UP,, DOWN", "ADD 1,"},
+			want: diagnostic.List{
+				{Line: 1, ColumnStart: 4, ColumnEnd: 5, Message: `unexpected ","`},
+				{Line: 2, ColumnStart: 8, ColumnEnd: 9, Message: `unexpected ","`},
+				{Line: 3, ColumnStart: 6, ColumnEnd: 7, Message: `unexpected ","`},
+			},
+		},
+		{
+			name: "every line is reported",
+			src:  []string{"ADD X", "SUB 1A"},
+			want: diagnostic.List{
+				{Line: 1, ColumnStart: 5, ColumnEnd: 6, Message: `invalid operand "X"`},
+				{Line: 2, ColumnStart: 5, ColumnEnd: 7, Message: `invalid operand "1A"`},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, diags := Parse(3, tt.src)
+			for i := range tt.want {
+				tt.want[i].Node = 3
+			}
+			if !reflect.DeepEqual(diags, tt.want) {
+				t.Errorf("Parse(%q) diagnostics = %+v, want %+v", tt.src, diags, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseLabels(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     []string
+		want    diagnostic.List
+		targets []uint8
+	}{
+		{
+			name:    "forward and backward jumps",
+			src:     []string{"START: JMP END", "NOP", "END:", "JMP START"},
+			targets: []uint8{2, 0},
+		},
+		{
+			name:    "labels are case-insensitive",
+			src:     []string{"loop: ADD 1", "JMP LOOP"},
+			targets: []uint8{0},
+		},
+		{
+			name:    "several labels on one line",
+			src:     []string{"A: B: NOP", "JEZ A", "JMP B"},
+			targets: []uint8{0, 0},
+		},
+		{
+			name: "undefined label",
+			src:  []string{"JMP NOWHERE"},
+			want: diagnostic.List{
+				{Line: 1, ColumnStart: 5, ColumnEnd: 12, Message: `undefined label "NOWHERE"`},
+			},
+		},
+		{
+			name: "duplicate label",
+			src:  []string{"A: NOP", "a: NOP", "JMP A"},
+			want: diagnostic.List{
+				{Line: 2, ColumnStart: 1, ColumnEnd: 2, Message: `label "A" is already defined on line 1`},
+			},
+		},
+		{
+			name: "register shadowing",
+			src:  []string{"ACC: NOP"},
+			want: diagnostic.List{
+				{Line: 1, ColumnStart: 1, ColumnEnd: 4, Message: `label "ACC" shadows a register name`},
+			},
+		},
+		{
+			name: "instruction shadowing",
+			src:  []string{"MOV: NOP"},
+			want: diagnostic.List{
+				{Line: 1, ColumnStart: 1, ColumnEnd: 4, Message: `label "MOV" shadows an instruction name`},
+			},
+		},
+		{
+			name: "literal target",
+			src:  []string{"JMP 1"},
+			want: diagnostic.List{
+				{Line: 1, ColumnStart: 5, ColumnEnd: 6, Message: `expected label, found "1"`},
+			},
+		},
+		{
+			name: "unused label",
+			src:  []string{"NOP", "  X: NOP"},
+			want: diagnostic.List{
+				{Line: 2, ColumnStart: 3, ColumnEnd: 4, Severity: diagnostic.WARNING, Message: `label "X" is never used`},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prog, diags := Parse(5, tt.src)
+			if tt.want == nil {
+				tt.want = diagnostic.List{}
+			}
+			for i := range tt.want {
+				tt.want[i].Node = 5
+			}
+			if !reflect.DeepEqual(diags, tt.want) {
+				t.Fatalf("Parse(%q) diagnostics = %+v, want %+v", tt.src, diags, tt.want)
+			}
+
+			targets := make([]uint8, 0)
+			for _, stmt := range prog.Statements {
+				if stmt.Instruction == nil {
+					continue
+				}
+				for _, operand := range stmt.Instruction.Operands {
+					if operand.Kind == LABEL {
+						targets = append(targets, operand.Target)
+					}
+				}
+			}
+			if tt.targets != nil && !reflect.DeepEqual(targets, tt.targets) {
+				t.Errorf("Parse(%q) targets = %v, want %v", tt.src, targets, tt.targets)
+			}
+		})
+	}
+}
@@ -0,0 +1,257 @@
+package program
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/franchesko/assembly-labyrinth/src/internal/emu"
+	"github.com/franchesko/assembly-labyrinth/src/internal/emu/node"
+)
+
+type WaitKind uint8
+type PeerKind uint8
+
+const (
+	READ WaitKind = iota
+	WRITE
+)
+
+const (
+	NO_PEER PeerKind = iota
+	GRID_NODE
+	EMPTY_NODE
+	INPUT_STREAM
+	OUTPUT_STREAM
+)
+
+// Wait is a blocked grid node and the port it waits to read from or write
+// to. Peer tells what is at the other end of the port, PeerIndex being the
+// index of the node or stream.
+type Wait struct {
+	Node       uint8
+	Kind       WaitKind
+	Port       emu.LocationDirection
+	Peer       PeerKind
+	PeerIndex  uint8
+	Deadlocked bool
+}
+
+// Analysis describes the blocked nodes of a halted program. Deadlocks are
+// the groups of nodes that wait on each other in a cycle.
+type Analysis struct {
+	Waits     []Wait
+	Deadlocks [][]uint8
+}
+
+var directionNames = map[emu.LocationDirection]string{
+	emu.UP:    "UP",
+	emu.RIGHT: "RIGHT",
+	emu.DOWN:  "DOWN",
+	emu.LEFT:  "LEFT",
+	emu.ANY:   "ANY",
+	emu.LAST:  "LAST",
+}
+
+func (w Wait) String() string {
+	action, preposition := "read", "from"
+	if w.Kind == WRITE {
+		action, preposition = "write", "to"
+	}
+
+	msg := fmt.Sprintf("node %d waiting to %s %s", w.Node, action, directionNames[w.Port])
+	switch w.Peer {
+	case GRID_NODE:
+		msg += fmt.Sprintf(" %s node %d", preposition, w.PeerIndex)
+	case EMPTY_NODE:
+		msg += fmt.Sprintf(" %s node %d, which has no code", preposition, w.PeerIndex)
+	case INPUT_STREAM:
+		msg += fmt.Sprintf(" %s input stream %d", preposition, w.PeerIndex)
+	case OUTPUT_STREAM:
+		msg += fmt.Sprintf(" %s output stream %d", preposition, w.PeerIndex)
+	default:
+		if w.Port != emu.ANY {
+			msg += ", which has no node"
+		}
+	}
+	if w.Deadlocked {
+		msg += " (deadlocked)"
+	}
+	return msg
+}
+
+// Analyze finds what every blocked grid node waits on and the cycles in
+// the resulting wait-for graph.
+func (p *Program) Analyze() Analysis {
+	analysis := Analysis{
+		Waits:     make([]Wait, 0),
+		Deadlocks: make([][]uint8, 0),
+	}
+
+	edges := make(map[uint8][]uint8)
+	for _, n := range p.Nodes {
+		if !n.Blocked || len(n.Instructions) == 0 {
+			continue
+		}
+		wait, ok := p.wait(n)
+		if !ok {
+			continue
+		}
+		analysis.Waits = append(analysis.Waits, wait)
+
+		if wait.Peer == GRID_NODE {
+			edges[n.Index] = append(edges[n.Index], wait.PeerIndex)
+		} else if wait.Port == emu.ANY {
+			for _, port := range n.Ports {
+				if port != nil && p.isGridNode(port) {
+					edges[n.Index] = append(edges[n.Index], port.Index)
+				}
+			}
+		}
+	}
+
+	deadlocked := make(map[uint8]bool)
+	for _, cycle := range cycles(edges) {
+		for _, index := range cycle {
+			deadlocked[index] = true
+		}
+		analysis.Deadlocks = append(analysis.Deadlocks, cycle)
+	}
+	for i := range analysis.Waits {
+		analysis.Waits[i].Deadlocked = deadlocked[analysis.Waits[i].Node]
+	}
+
+	return analysis
+}
+
+// wait tells what the blocked node waits on: a pending write, or else the
+// port its current instruction reads from or writes to.
+func (p *Program) wait(n *node.Node) (Wait, bool) {
+	wait := Wait{
+		Node: n.Index,
+	}
+	ins := n.Instructions[cursor(n)]
+
+	switch {
+	case n.OutputPort != nil:
+		wait.Kind = WRITE
+		for dir, port := range n.Ports {
+			if port == n.OutputPort {
+				wait.Port = emu.LocationDirection(dir)
+			}
+		}
+		p.setPeer(&wait, n.OutputPort)
+	case ins.SrcType == emu.ADDRESS && isPort(ins.Src.Direction):
+		wait.Kind = READ
+		wait.Port = ins.Src.Direction
+		p.setPeer(&wait, p.peer(n, ins.Src.Direction))
+	case ins.Operation == emu.MOV && isPort(ins.Dest.Direction):
+		wait.Kind = WRITE
+		wait.Port = ins.Dest.Direction
+		p.setPeer(&wait, p.peer(n, ins.Dest.Direction))
+	default:
+		return Wait{}, false
+	}
+	return wait, true
+}
+
+func (p *Program) peer(n *node.Node, dir emu.LocationDirection) *node.Node {
+	switch dir {
+	case emu.ANY:
+		return nil
+	case emu.LAST:
+		return n.Last
+	default:
+		return n.Ports[dir]
+	}
+}
+
+func (p *Program) setPeer(wait *Wait, peer *node.Node) {
+	switch {
+	case peer == nil:
+		wait.Peer = NO_PEER
+	case p.isGridNode(peer) && len(peer.Instructions) == 0:
+		wait.Peer = EMPTY_NODE
+	case p.isGridNode(peer):
+		wait.Peer = GRID_NODE
+	case peer.Output != nil:
+		wait.Peer = OUTPUT_STREAM
+	default:
+		wait.Peer = INPUT_STREAM
+	}
+	if peer != nil {
+		wait.PeerIndex = peer.Index
+	}
+}
+
+func isPort(dir emu.LocationDirection) bool {
+	_, ok := directionNames[dir]
+	return ok
+}
+
+// cycles returns the strongly connected components of the graph that
+// contain a cycle, each sorted by node index.
+func cycles(edges map[uint8][]uint8) [][]uint8 {
+	index := make(map[uint8]int)
+	low := make(map[uint8]int)
+	onStack := make(map[uint8]bool)
+	stack := make([]uint8, 0)
+	found := make([][]uint8, 0)
+	counter := 0
+
+	var visit func(v uint8)
+	visit = func(v uint8) {
+		index[v] = counter
+		low[v] = counter
+		counter++
+		stack = append(stack, v)
+		onStack[v] = true
+
+		for _, w := range edges[v] {
+			if _, seen := index[w]; !seen {
+				visit(w)
+				low[v] = min(low[v], low[w])
+			} else if onStack[w] {
+				low[v] = min(low[v], index[w])
+			}
+		}
+
+		if low[v] != index[v] {
+			return
+		}
+		component := make([]uint8, 0)
+		for {
+			w := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[w] = false
+			component = append(component, w)
+			if w == v {
+				break
+			}
+		}
+		if len(component) > 1 || selfLoop(edges, v) {
+			sort.Slice(component, func(i, j int) bool { return component[i] < component[j] })
+			found = append(found, component)
+		}
+	}
+
+	nodes := make([]uint8, 0, len(edges))
+	for v := range edges {
+		nodes = append(nodes, v)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i] < nodes[j] })
+	for _, v := range nodes {
+		if _, seen := index[v]; !seen {
+			visit(v)
+		}
+	}
+	return found
+}
+
+func selfLoop(edges map[uint8][]uint8, v uint8) bool {
+	for _, w := range edges[v] {
+		if w == v {
+			return true
+		}
+	}
+	return false
+}
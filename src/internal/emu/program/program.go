@@ -1,51 +1,128 @@
 package program
 
 import (
+	"context"
 	"errors"
-	"strings"
+	"fmt"
 
 	"github.com/franchesko/assembly-labyrinth/src/internal/emu"
-	"github.com/franchesko/assembly-labyrinth/src/internal/emu/inputcode"
+	"github.com/franchesko/assembly-labyrinth/src/internal/emu/diagnostic"
 	"github.com/franchesko/assembly-labyrinth/src/internal/emu/node"
 	"github.com/franchesko/assembly-labyrinth/src/internal/emu/nodelist"
+	"github.com/franchesko/assembly-labyrinth/src/internal/emu/parser"
 )
 
 type Program struct {
-	Nodes       []*node.Node
-	NodeList    *nodelist.NodeList
-	ActiveNodes *nodelist.NodeList
+	Nodes          []*node.Node
+	NodeList       *nodelist.NodeList
+	ActiveNodes    *nodelist.NodeList
+	Output         *emu.Output
+	Cycle          int
+	Stats          Stats
+	Warnings       diagnostic.List
+	Trace          []TraceCycle
+	TraceTruncated bool
+	idleCycles     int
+	recorder       *node.Recorder
+	traceLimit     int
+	traceSink      func(TraceCycle)
+	traced         int
 }
 
-func Run(streams []emu.Stream, nodesCode []emu.NodeCode) ([]emu.Stream, error) {
-	prog := NewProgram()
-	if err := prog.LoadStreams(streams); err != nil {
+// Options configure a run. With Trace the result holds a trace of at most
+// TraceLimit cycles, or of every cycle if TraceLimit is 0. With OnTrace the
+// cycles are passed to it as they are recorded instead.
+type Options struct {
+	MaxCycles  int
+	Trace      bool
+	TraceLimit int
+	OnTrace    func(TraceCycle)
+}
+
+// Stats are the metrics solutions are compared by. Cycles counts the
+// cycles until the last one in which any node was not blocked.
+type Stats struct {
+	Cycles       int
+	Nodes        int
+	Instructions int
+}
+
+// Result of a finished run. Analysis describes the nodes that were still
+// blocked when the program halted, Emitted holds the cycle each output value
+// was written in by stream index.
+type Result struct {
+	Output         []emu.Stream
+	Emitted        map[uint8][]int
+	Stats          Stats
+	Warnings       diagnostic.List
+	Trace          []TraceCycle
+	TraceTruncated bool
+	Analysis       Analysis
+}
+
+// haltCycles is the number of consecutive cycles in which every node is
+// blocked after which a program is considered finished.
+const haltCycles = 5
+
+var ErrTimedOut = errors.New("program timed out")
+
+// Run loads the program and runs it until it halts. When it times out, the
+// returned result only holds the warnings and the trace recorded so far.
+func Run(ctx context.Context, layout []emu.NodeLayout, streams []emu.Stream, nodesCode []emu.NodeCode, opts Options) (*Result, error) {
+	prog, err := Load(layout, streams, nodesCode)
+	if err != nil {
 		return nil, err
 	}
-	if err := prog.LoadCode(nodesCode); err != nil {
-		return nil, err
+	if opts.Trace {
+		prog.EnableTrace(opts.TraceLimit, opts.OnTrace)
 	}
 
-	dtmCount := 0
-	for dtmCount < 5 {
-		allBlocked, err := prog.Tick()
-		if err != nil {
-			emu.ClearOutput()
+	for !prog.Halted() {
+		if opts.MaxCycles > 0 && prog.Cycle >= opts.MaxCycles {
+			return prog.partialResult(), fmt.Errorf("%w: exceeded %d cycles", ErrTimedOut, opts.MaxCycles)
+		}
+		if err := prog.Step(ctx); err != nil {
+			if errors.Is(err, ErrTimedOut) {
+				return prog.partialResult(), err
+			}
 			return nil, err
 		}
+	}
 
-		if allBlocked {
-			dtmCount++
-		} else {
-			dtmCount = 0
-		}
+	return &Result{
+		Output:         prog.Output.GetOutput(),
+		Emitted:        prog.Output.GetCycles(),
+		Stats:          prog.Stats,
+		Warnings:       prog.Warnings,
+		Trace:          prog.Trace,
+		TraceTruncated: prog.TraceTruncated,
+		Analysis:       prog.Analyze(),
+	}, nil
+}
+
+// partialResult is what Run returns for a program that timed out.
+func (p *Program) partialResult() *Result {
+	return &Result{
+		Warnings:       p.Warnings,
+		Trace:          p.Trace,
+		TraceTruncated: p.TraceTruncated,
 	}
+}
 
-	output := emu.GetOutput()
-	emu.ClearOutput()
-	return output, nil
+// Load creates a program with the streams and code loaded, ready to be
+// stepped through.
+func Load(layout []emu.NodeLayout, streams []emu.Stream, nodesCode []emu.NodeCode) (*Program, error) {
+	prog := NewProgram(layout)
+	if err := prog.LoadStreams(streams); err != nil {
+		return nil, err
+	}
+	if err := prog.LoadCode(nodesCode); err != nil {
+		return nil, err
+	}
+	return prog, nil
 }
 
-func NewProgram() *Program {
+func NewProgram(layout []emu.NodeLayout) *Program {
 	nodes := make([]*node.Node, 0, emu.NodesNumber)
 	var n *node.Node
 	for i := range emu.NodesNumber {
@@ -54,23 +131,32 @@ func NewProgram() *Program {
 		n.Index = uint8(i)
 		nodes = append(nodes, n)
 	}
+	for _, nl := range layout {
+		if int(nl.Index) < len(nodes) && nl.Type == emu.DAMAGED {
+			nodes[nl.Index].Damaged = true
+		}
+	}
 	p := &Program{
 		Nodes:       nodes,
 		NodeList:    nil,
 		ActiveNodes: nil,
+		Output:      emu.NewOutput(),
 	}
 
 	for i := range p.Nodes {
-		if i != 8 && i != 9 && i != 10 && i != 11 {
+		if p.Nodes[i].Damaged {
+			continue
+		}
+		if i != 8 && i != 9 && i != 10 && i != 11 && !p.Nodes[i+4].Damaged {
 			p.Nodes[i].Ports[emu.DOWN] = p.Nodes[i+4]
 		}
-		if i != 0 && i != 1 && i != 2 && i != 3 {
+		if i != 0 && i != 1 && i != 2 && i != 3 && !p.Nodes[i-4].Damaged {
 			p.Nodes[i].Ports[emu.UP] = p.Nodes[i-4]
 		}
-		if i != 3 && i != 7 && i != 11 {
+		if i != 3 && i != 7 && i != 11 && !p.Nodes[i+1].Damaged {
 			p.Nodes[i].Ports[emu.RIGHT] = p.Nodes[i+1]
 		}
-		if i != 0 && i != 4 && i != 8 {
+		if i != 0 && i != 4 && i != 8 && !p.Nodes[i-1].Damaged {
 			p.Nodes[i].Ports[emu.LEFT] = p.Nodes[i-1]
 		}
 	}
@@ -78,7 +164,13 @@ func NewProgram() *Program {
 	return p
 }
 
-func (p *Program) Tick() (bool, error) {
+func (p *Program) Tick(ctx context.Context) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, fmt.Errorf("%w: %w", ErrTimedOut, err)
+	}
+
+	cycle := p.beginTrace()
+	p.Output.SetCycle(p.Cycle + 1)
 	allBlocked := true
 	var err error
 	for list := p.ActiveNodes; list != nil; list = list.Next {
@@ -87,9 +179,35 @@ func (p *Program) Tick() (bool, error) {
 		}
 		allBlocked = allBlocked && list.Node.Blocked
 	}
+	p.Cycle++
+	if cycle != nil {
+		p.endTrace(cycle)
+	}
 	return allBlocked, nil
 }
 
+// Step runs one cycle and keeps track of whether the program has halted.
+func (p *Program) Step(ctx context.Context) error {
+	allBlocked, err := p.Tick(ctx)
+	if err != nil {
+		return err
+	}
+
+	if allBlocked {
+		p.idleCycles++
+	} else {
+		p.idleCycles = 0
+		p.Stats.Cycles = p.Cycle
+	}
+	return nil
+}
+
+// Halted reports whether every node has been blocked for haltCycles
+// cycles in a row.
+func (p *Program) Halted() bool {
+	return p.idleCycles >= haltCycles
+}
+
 func (p *Program) LoadStreams(streams []emu.Stream) error {
 	for _, stream := range streams {
 		if stream.Type == emu.IN {
@@ -105,32 +223,53 @@ func (p *Program) LoadStreams(streams []emu.Stream) error {
 	return nil
 }
 
+// LoadCode parses and assembles the code of every node. It fails with the
+// diagnostics if any of them is an error, otherwise the warnings are kept
+// in Warnings.
 func (p *Program) LoadCode(nodesCode []emu.NodeCode) error {
 	if len(nodesCode) != emu.NodesNumber {
 		return errors.New("wrong nodes number")
 	}
 
-	allInput := make([]inputcode.InputCode, 0)
-	for range emu.NodesNumber {
-		allInput = append(allInput, inputcode.NewInputCode())
-	}
-
+	diags := make(diagnostic.List, 0)
 	for i, nodeCode := range nodesCode {
-		for _, line := range nodeCode.Code {
-			formatted := strings.ToUpper(strings.TrimSpace(line))
-			allInput[i].AddLine(formatted)
-		}
-	}
+		n := p.Nodes[i]
+		prog, nodeDiags := parser.Parse(n.Index, nodeCode.Code)
+		diags = append(diags, nodeDiags...)
 
-	for _, n := range p.Nodes {
-		if err := n.ParseCode(&allInput[n.Index]); err != nil {
-			return err
+		if n.Damaged && len(prog.Statements) > 0 {
+			line := prog.Statements[0].Line
+			diags = append(diags, diagnostic.Diagnostic{
+				Node:        n.Index,
+				Line:        line,
+				ColumnStart: 1,
+				ColumnEnd:   len(nodeCode.Code[line-1]) + 1,
+				Severity:    diagnostic.ERROR,
+				Message:     "node is damaged and cannot contain code",
+			})
+			continue
+		}
+		if nodeDiags.HasErrors() {
+			continue
 		}
+
+		n.Assemble(prog)
 		if len(n.Instructions) > 0 {
 			p.ActiveNodes = nodelist.Append(p.ActiveNodes, n)
+			p.Stats.Nodes++
+		}
+		for _, stmt := range prog.Statements {
+			if stmt.Instruction != nil {
+				p.Stats.Instructions++
+			}
 		}
 	}
 
+	diags.Sort()
+	if diags.HasErrors() {
+		return diags
+	}
+	p.Warnings = diags
 	return nil
 }
 
@@ -142,6 +281,7 @@ func (p *Program) createNode() *node.Node {
 
 func (p *Program) createInputNode(stream emu.Stream) *node.Node {
 	inputNode := p.createNode()
+	inputNode.Index = stream.Index
 	belowNode := p.Nodes[stream.Index]
 
 	inputNode.Ports[emu.DOWN] = belowNode
@@ -176,8 +316,9 @@ func (p *Program) createOutputNode(stream emu.Stream) *node.Node {
 	ins.DestType = emu.ADDRESS
 	ins.Dest.Direction = emu.ACC
 	outputNode.CreateInstruction(emu.RES)
+	outputNode.Output = p.Output
 
-	emu.AddOutputStream(emu.NewOutputStream(stream.Index))
+	p.Output.AddOutputStream(emu.NewOutputStream(stream.Index))
 
 	return outputNode
 }
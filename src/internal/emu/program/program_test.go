@@ -0,0 +1,63 @@
+package program
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/franchesko/assembly-labyrinth/src/internal/emu"
+	"github.com/franchesko/assembly-labyrinth/src/internal/files"
+	"github.com/franchesko/assembly-labyrinth/src/internal/generator"
+)
+
+// TestRunConcurrent runs the double level from many goroutines at once and
+// checks that every run only sees its own inputs. Run it with -race.
+func TestRunConcurrent(t *testing.T) {
+	info, err := files.LoadLevelInfo("../../../../data/level/double.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := files.LoadNodesCode("../../../../data/code/double.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const goroutines = 32
+	const runs = 10
+	var wg sync.WaitGroup
+	for g := range goroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := range runs {
+				streams := make([]emu.Stream, len(info.Streams))
+				copy(streams, info.Streams)
+				generator.Generate(streams, int64(g*runs+r))
+
+				res, err := Run(context.Background(), info.Layout, streams, code, Options{})
+				if err != nil {
+					t.Errorf("goroutine %d: %s", g, err)
+					return
+				}
+				if len(res.Output) != 1 {
+					t.Errorf("goroutine %d: got %d output streams, want 1", g, len(res.Output))
+					return
+				}
+
+				in := streams[0].Values
+				out := res.Output[0].Values
+				if len(out) != len(in) {
+					t.Errorf("goroutine %d: got %d output values, want %d", g, len(out), len(in))
+					return
+				}
+				for i := range in {
+					if out[i] != 2*in[i] {
+						t.Errorf("goroutine %d: value %d is %d, want %d", g, i, out[i], 2*in[i])
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,110 @@
+package program
+
+import (
+	"github.com/franchesko/assembly-labyrinth/src/internal/emu"
+	"github.com/franchesko/assembly-labyrinth/src/internal/emu/node"
+)
+
+// State is a snapshot of the program between two cycles.
+type State struct {
+	Cycle   int
+	Halted  bool
+	Nodes   []NodeState
+	Streams []StreamState
+}
+
+// NodeState is the state of a grid node. Line is the source line of the
+// instruction the node executes next, 0 if the node has no code. A node
+// that is Writing waits for OutputValue to be read from OutputPort.
+type NodeState struct {
+	Index          uint8
+	Damaged        bool
+	CursorPosition uint8
+	Line           int
+	ACC            int16
+	BAK            int16
+	Blocked        bool
+	Writing        bool
+	OutputPort     emu.LocationDirection
+	OutputValue    int16
+}
+
+// StreamState tells how many values of an input stream were consumed or
+// how many values an output stream has produced so far.
+type StreamState struct {
+	Index    uint8
+	Type     emu.StreamType
+	Position int
+	Length   int
+	Values   []int16
+}
+
+func (p *Program) State() State {
+	state := State{
+		Cycle:   p.Cycle,
+		Halted:  p.Halted(),
+		Nodes:   make([]NodeState, 0, len(p.Nodes)),
+		Streams: make([]StreamState, 0),
+	}
+
+	for _, n := range p.Nodes {
+		ns := NodeState{
+			Index:          n.Index,
+			Damaged:        n.Damaged,
+			CursorPosition: cursor(n),
+			Line:           p.Line(n.Index),
+			ACC:            n.ACC,
+			BAK:            n.BAK,
+			Blocked:        n.Blocked,
+			Writing:        n.OutputPort != nil,
+			OutputValue:    n.OutputValue,
+		}
+		for dir, port := range n.Ports {
+			if port != nil && port == n.OutputPort {
+				ns.OutputPort = emu.LocationDirection(dir)
+			}
+		}
+		state.Nodes = append(state.Nodes, ns)
+	}
+
+	for list := p.NodeList; list != nil; list = list.Next {
+		n := list.Node
+		if n.Output != nil {
+			values := p.Output.Values(n.Index)
+			state.Streams = append(state.Streams, StreamState{
+				Index:    n.Index,
+				Type:     emu.OUT,
+				Position: len(values),
+				Values:   values,
+			})
+		} else {
+			state.Streams = append(state.Streams, StreamState{
+				Index:    n.Index,
+				Type:     emu.IN,
+				Position: int(n.CursorPosition),
+				Length:   len(n.Instructions) - 1,
+			})
+		}
+	}
+
+	return state
+}
+
+// cursor returns the position of the instruction the node executes next.
+// The cursor is only wrapped around at the start of a tick.
+func cursor(n *node.Node) uint8 {
+	if int(n.CursorPosition) >= len(n.Instructions) {
+		return 0
+	}
+	return n.CursorPosition
+}
+
+// Line returns the source line of the instruction the node executes next,
+// 0 if the node has no code.
+func (p *Program) Line(index uint8) int {
+	n := p.Nodes[index]
+	if len(n.Instructions) == 0 {
+		return 0
+	}
+	return n.Instructions[cursor(n)].Line
+}
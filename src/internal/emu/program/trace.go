@@ -0,0 +1,135 @@
+package program
+
+import (
+	"github.com/franchesko/assembly-labyrinth/src/internal/emu/node"
+)
+
+type TransferKind uint8
+
+const (
+	NODE TransferKind = iota
+	INPUT
+	OUTPUT
+)
+
+// TraceCycle is what happened in one cycle of a traced program. Nodes are
+// the grid nodes with code, Line being the instruction each one executed
+// or was blocked on.
+type TraceCycle struct {
+	Cycle     int
+	Nodes     []NodeTrace
+	Transfers []Transfer
+	Outputs   []TraceOutput
+}
+
+type NodeTrace struct {
+	Index   uint8
+	Line    int
+	Blocked bool
+}
+
+// Transfer is a value a node read from another one. Input and output
+// streams are given by the index of the grid node they are attached to.
+type Transfer struct {
+	Kind  TransferKind
+	From  uint8
+	To    uint8
+	Value int16
+}
+
+// TraceOutput is a value written to an output stream.
+type TraceOutput struct {
+	Stream uint8
+	Value  int16
+}
+
+// EnableTrace makes the program record a trace of at most limit cycles,
+// or of every cycle if limit is 0. Recorded cycles are passed to sink if it
+// is set, otherwise they are kept in Trace. It must be called after the
+// streams are loaded.
+func (p *Program) EnableTrace(limit int, sink func(TraceCycle)) {
+	p.recorder = &node.Recorder{}
+	p.traceLimit = limit
+	p.traceSink = sink
+	p.Trace = make([]TraceCycle, 0)
+	p.setRecorder(p.recorder)
+}
+
+func (p *Program) setRecorder(recorder *node.Recorder) {
+	for _, n := range p.Nodes {
+		n.Recorder = recorder
+	}
+	for list := p.NodeList; list != nil; list = list.Next {
+		list.Node.Recorder = recorder
+	}
+}
+
+// beginTrace records the instruction every grid node with code is about
+// to execute. A cycle run after the limit was reached marks the trace as
+// truncated.
+func (p *Program) beginTrace() *TraceCycle {
+	if p.recorder == nil {
+		if p.traceLimit > 0 && p.traced >= p.traceLimit {
+			p.TraceTruncated = true
+		}
+		return nil
+	}
+
+	cycle := &TraceCycle{
+		Nodes: make([]NodeTrace, 0),
+	}
+	for list := p.ActiveNodes; list != nil; list = list.Next {
+		if n := list.Node; p.isGridNode(n) {
+			cycle.Nodes = append(cycle.Nodes, NodeTrace{
+				Index: n.Index,
+				Line:  p.Line(n.Index),
+			})
+		}
+	}
+	return cycle
+}
+
+func (p *Program) endTrace(cycle *TraceCycle) {
+	cycle.Cycle = p.Cycle
+	for i := range cycle.Nodes {
+		cycle.Nodes[i].Blocked = p.Nodes[cycle.Nodes[i].Index].Blocked
+	}
+
+	for _, t := range p.recorder.Transfers {
+		transfer := Transfer{
+			Kind:  NODE,
+			From:  t.From.Index,
+			To:    t.To.Index,
+			Value: t.Value,
+		}
+		if !p.isGridNode(t.From) {
+			transfer.Kind = INPUT
+		} else if !p.isGridNode(t.To) {
+			transfer.Kind = OUTPUT
+		}
+		cycle.Transfers = append(cycle.Transfers, transfer)
+	}
+	for _, r := range p.recorder.Results {
+		cycle.Outputs = append(cycle.Outputs, TraceOutput{
+			Stream: r.Node.Index,
+			Value:  r.Value,
+		})
+	}
+	p.recorder.Transfers = p.recorder.Transfers[:0]
+	p.recorder.Results = p.recorder.Results[:0]
+
+	p.traced++
+	if p.traceSink != nil {
+		p.traceSink(*cycle)
+	} else {
+		p.Trace = append(p.Trace, *cycle)
+	}
+	if p.traceLimit > 0 && p.traced >= p.traceLimit {
+		p.recorder = nil
+		p.setRecorder(nil)
+	}
+}
+
+func (p *Program) isGridNode(n *node.Node) bool {
+	return int(n.Index) < len(p.Nodes) && p.Nodes[n.Index] == n
+}
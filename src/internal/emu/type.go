@@ -5,6 +5,8 @@ type NodeType uint8
 type Operation uint8
 type LocationType uint8
 type LocationDirection uint8
+type GeneratorKind uint8
+type DeriveOperation uint8
 
 const (
 	IN StreamType = iota
@@ -33,6 +35,23 @@ const (
 	RES
 )
 
+const (
+	UNIFORM GeneratorKind = iota
+	CONSTANT
+	SEQUENCE
+	SORTED
+	UNIQUE
+	CHOICE
+	DERIVED
+)
+
+const (
+	COPY DeriveOperation = iota
+	NEGATE
+	OFFSET
+	JITTER
+)
+
 const (
 	NUMBER LocationType = iota
 	ADDRESS
@@ -54,21 +73,54 @@ type Location struct {
 	Direction LocationDirection
 }
 
+// Instruction is an assembled instruction. Line is the source line it was
+// assembled from, 0 for instructions generated by the emulator.
 type Instruction struct {
 	Operation Operation
 	SrcType   LocationType
 	Src       Location
 	DestType  LocationType
 	Dest      Location
+	Line      int
 }
 
 type Stream struct {
-	Index    uint8      `json:"index"`
-	Name     string     `json:"name,omitempty"`
-	Type     StreamType `json:"type,omitempty"`
-	Values   []int16    `json:"values,omitempty"`
-	MaxValue int16      `json:"max_value,omitempty"`
-	MinValue int16      `json:"min_value,omitempty"`
+	Index     uint8      `json:"index"`
+	Name      string     `json:"name,omitempty"`
+	Type      StreamType `json:"type,omitempty"`
+	Values    []int16    `json:"values,omitempty"`
+	MaxValue  int16      `json:"max_value,omitempty"`
+	MinValue  int16      `json:"min_value,omitempty"`
+	Generator *Generator `json:"generator,omitempty"`
+}
+
+// Generator describes how the values of an input stream are generated.
+// Values are drawn from [MinValue, MaxValue) of the stream unless the kind
+// says otherwise:
+//   - UNIFORM: independent values, the default without a generator;
+//   - CONSTANT: every value is Value;
+//   - SEQUENCE: zero-terminated runs of non-zero values, each run is
+//     MinLength to MaxLength values long;
+//   - SORTED: values in ascending order, or descending with Descending;
+//   - UNIQUE: no value appears twice;
+//   - CHOICE: values picked from Values with the given Weights;
+//   - DERIVED: values of the input stream Source transformed by Derive,
+//     OFFSET adds Value and JITTER adds a value from the range.
+type Generator struct {
+	Kind       GeneratorKind   `json:"kind"`
+	Value      int16           `json:"value,omitempty"`
+	Values     []int16         `json:"values,omitempty"`
+	Weights    []uint16        `json:"weights,omitempty"`
+	MinLength  uint8           `json:"min_length,omitempty"`
+	MaxLength  uint8           `json:"max_length,omitempty"`
+	Descending bool            `json:"descending,omitempty"`
+	Source     uint8           `json:"source,omitempty"`
+	Derive     DeriveOperation `json:"derive,omitempty"`
+}
+
+type NodeLayout struct {
+	Index uint8    `json:"index"`
+	Type  NodeType `json:"type"`
 }
 
 type NodeCode struct {
@@ -9,17 +9,53 @@ import (
 )
 
 type LevelInfo struct {
-	Title       string       `json:"title"`
-	Description string       `json:"description"`
-	Layout      []nodeLayout `json:"layout"`
-	Streams     []emu.Stream `json:"streams"`
+	Title         string           `json:"title"`
+	Description   string           `json:"description"`
+	Difficulty    uint8            `json:"difficulty,omitempty"`
+	Tags          []string         `json:"tags,omitempty"`
+	Order         int              `json:"order,omitempty"`
+	Prerequisites []string         `json:"prerequisites,omitempty"`
+	Layout        []emu.NodeLayout `json:"layout"`
+	Streams       []emu.Stream     `json:"streams"`
+	Tests         []TestCase       `json:"tests,omitempty"`
 }
 
-type nodeLayout struct {
-	Index uint8        `json:"index"`
-	Type  emu.NodeType `json:"type"`
+// TestCase is a hand-written set of input values that is checked on every
+// run in addition to the generated ones. Input streams it does not list
+// are generated as usual.
+type TestCase struct {
+	Name string        `json:"name,omitempty"`
+	In   []StreamInput `json:"in"`
 }
 
+type StreamInput struct {
+	Index  uint8   `json:"index"`
+	Values []int16 `json:"values"`
+}
+
+// Apply replaces the values of the input streams listed in the test case.
+func (tc TestCase) Apply(streams []emu.Stream) {
+	for _, in := range tc.In {
+		for i := range streams {
+			if streams[i].Type == emu.IN && streams[i].Index == in.Index {
+				streams[i].Values = in.Values
+			}
+		}
+	}
+}
+
+// Overrides returns the indexes of the input streams listed in the test
+// case.
+func (tc TestCase) Overrides() map[uint8]bool {
+	overrides := make(map[uint8]bool, len(tc.In))
+	for _, in := range tc.In {
+		overrides[in.Index] = true
+	}
+	return overrides
+}
+
+// LoadLevels returns the ids of the levels in dirPath, which are the names
+// of its JSON files without the extension.
 func LoadLevels(dirPath string) ([]string, error) {
 	files, err := os.ReadDir(dirPath)
 	if err != nil {
@@ -28,7 +64,11 @@ func LoadLevels(dirPath string) ([]string, error) {
 
 	levels := make([]string, 0)
 	for _, file := range files {
-		levels = append(levels, strings.Split(file.Name(), ".")[0])
+		id, ok := strings.CutSuffix(file.Name(), ".json")
+		if !ok || id == "" || !file.Type().IsRegular() {
+			continue
+		}
+		levels = append(levels, id)
 	}
 
 	return levels, nil
@@ -0,0 +1,302 @@
+package generator
+
+import (
+	"math/rand"
+	"sort"
+
+	"github.com/franchesko/assembly-labyrinth/src/internal/emu"
+)
+
+const (
+	defaultMinLength = 1
+	defaultMaxLength = 4
+)
+
+// Generate fills the input streams with values generated from seed, so the
+// same seed always yields the same inputs. Derived streams are filled after
+// the streams they depend on.
+func Generate(streams []emu.Stream, seed int64) {
+	rng := rand.New(rand.NewSource(seed))
+	done := make(map[uint8]bool)
+	for i := range streams {
+		gen := streams[i].Generator
+		if streams[i].Type != emu.IN || (gen != nil && gen.Kind == emu.DERIVED) {
+			continue
+		}
+		streams[i].Values = generateValues(rng, streams[i])
+		done[streams[i].Index] = true
+	}
+	deriveStreams(rng, streams, done)
+}
+
+// Rederive recomputes the derived streams that depend on one of the changed
+// streams, directly or through other derived streams, so they follow values
+// written over the generated ones. Changed streams are left as they are.
+func Rederive(streams []emu.Stream, changed map[uint8]bool, seed int64) {
+	done := make(map[uint8]bool)
+	for i := range streams {
+		if streams[i].Type == emu.IN && !dependsOn(streams, streams[i], changed) {
+			done[streams[i].Index] = true
+		}
+	}
+	deriveStreams(rand.New(rand.NewSource(seed)), streams, done)
+}
+
+// deriveStreams fills the derived streams that are not done once their
+// source is.
+func deriveStreams(rng *rand.Rand, streams []emu.Stream, done map[uint8]bool) {
+	for progress := true; progress; {
+		progress = false
+		for i := range streams {
+			if streams[i].Type != emu.IN || done[streams[i].Index] || !done[streams[i].Generator.Source] {
+				continue
+			}
+			streams[i].Values = derive(rng, streams[i], findValues(streams, streams[i].Generator.Source))
+			done[streams[i].Index] = true
+			progress = true
+		}
+	}
+}
+
+// dependsOn reports whether stream is a derived stream that is not changed
+// itself but whose chain of sources reaches a changed stream.
+func dependsOn(streams []emu.Stream, stream emu.Stream, changed map[uint8]bool) bool {
+	if changed[stream.Index] {
+		return false
+	}
+	for range streams {
+		gen := stream.Generator
+		if gen == nil || gen.Kind != emu.DERIVED {
+			return false
+		}
+		if changed[gen.Source] {
+			return true
+		}
+		source, ok := findStream(streams, gen.Source)
+		if !ok {
+			return false
+		}
+		stream = source
+	}
+	return false
+}
+
+func generateValues(rng *rand.Rand, stream emu.Stream) []int16 {
+	gen := stream.Generator
+	if gen == nil {
+		return uniform(rng, stream.MinValue, stream.MaxValue)
+	}
+
+	switch gen.Kind {
+	case emu.CONSTANT:
+		return constant(gen.Value)
+	case emu.SEQUENCE:
+		return sequence(rng, stream.MinValue, stream.MaxValue, gen.MinLength, gen.MaxLength)
+	case emu.SORTED:
+		return sorted(rng, stream.MinValue, stream.MaxValue, gen.Descending)
+	case emu.UNIQUE:
+		return unique(rng, stream.MinValue, stream.MaxValue)
+	case emu.CHOICE:
+		return choice(rng, gen.Values, gen.Weights)
+	default:
+		return uniform(rng, stream.MinValue, stream.MaxValue)
+	}
+}
+
+func uniform(rng *rand.Rand, minValue, maxValue int16) []int16 {
+	out := make([]int16, 0, emu.StreamLength)
+	for range emu.StreamLength {
+		out = append(out, between(rng, minValue, maxValue))
+	}
+	return out
+}
+
+func constant(value int16) []int16 {
+	out := make([]int16, 0, emu.StreamLength)
+	for range emu.StreamLength {
+		out = append(out, value)
+	}
+	return out
+}
+
+// sequence generates zero-terminated runs of non-zero values. The stream
+// always ends with a terminator and every run is minLength to maxLength
+// values long, as long as SequenceFits allows the lengths.
+func sequence(rng *rand.Rand, minValue, maxValue int16, minLength, maxLength uint8) []int16 {
+	lo, hi := sequenceLengths(minLength, maxLength)
+	out := make([]int16, 0, emu.StreamLength)
+	for len(out) < emu.StreamLength {
+		left := emu.StreamLength - len(out)
+		lengths := make([]int, 0, hi-lo+1)
+		for length := lo; length <= hi; length++ {
+			if fillable(left-length-1, lo, hi) {
+				lengths = append(lengths, length)
+			}
+		}
+
+		length := left - 1
+		if len(lengths) > 0 {
+			length = lengths[rng.Intn(len(lengths))]
+		}
+		for range length {
+			out = append(out, nonZero(rng, minValue, maxValue))
+		}
+		out = append(out, 0)
+	}
+	return out
+}
+
+// SequenceFits reports whether a stream can be filled exactly with
+// zero-terminated runs of minLength to maxLength values.
+func SequenceFits(minLength, maxLength uint8) bool {
+	lo, hi := sequenceLengths(minLength, maxLength)
+	return fillable(emu.StreamLength, lo, hi)
+}
+
+// sequenceLengths applies the defaults to the run lengths of a sequence.
+func sequenceLengths(minLength, maxLength uint8) (int, int) {
+	if minLength == 0 {
+		minLength = defaultMinLength
+	}
+	if maxLength == 0 {
+		maxLength = defaultMaxLength
+	}
+	if maxLength < minLength {
+		maxLength = minLength
+	}
+	return int(minLength), int(maxLength)
+}
+
+// fillable reports whether n values can be split into zero-terminated runs
+// of lo to hi values, that is whether some number of runs k satisfies
+// k*(lo+1) <= n <= k*(hi+1).
+func fillable(n, lo, hi int) bool {
+	if n < 0 {
+		return false
+	}
+	fewest := (n + hi) / (hi + 1)
+	most := n / (lo + 1)
+	return fewest <= most
+}
+
+func sorted(rng *rand.Rand, minValue, maxValue int16, descending bool) []int16 {
+	out := uniform(rng, minValue, maxValue)
+	sort.Slice(out, func(i, j int) bool {
+		if descending {
+			return out[i] > out[j]
+		}
+		return out[i] < out[j]
+	})
+	return out
+}
+
+// unique generates values that do not repeat. When the range is smaller
+// than the stream, values only repeat once the whole range is used up.
+func unique(rng *rand.Rand, minValue, maxValue int16) []int16 {
+	out := make([]int16, 0, emu.StreamLength)
+	for len(out) < emu.StreamLength {
+		for _, v := range rng.Perm(max(int(maxValue-minValue), 1)) {
+			if len(out) == emu.StreamLength {
+				break
+			}
+			out = append(out, minValue+int16(v))
+		}
+	}
+	return out
+}
+
+func choice(rng *rand.Rand, values []int16, weights []uint16) []int16 {
+	if len(values) == 0 {
+		return constant(0)
+	}
+
+	total := 0
+	for i := range values {
+		total += weight(weights, i)
+	}
+
+	out := make([]int16, 0, emu.StreamLength)
+	for range emu.StreamLength {
+		pick := rng.Intn(max(total, 1))
+		for i, v := range values {
+			pick -= weight(weights, i)
+			if pick < 0 {
+				out = append(out, v)
+				break
+			}
+		}
+	}
+	return out
+}
+
+func derive(rng *rand.Rand, stream emu.Stream, source []int16) []int16 {
+	gen := stream.Generator
+	out := make([]int16, 0, len(source))
+	for _, v := range source {
+		switch gen.Derive {
+		case emu.NEGATE:
+			v = -v
+		case emu.OFFSET:
+			v = clamp(int(v) + int(gen.Value))
+		case emu.JITTER:
+			v = clamp(int(v) + int(between(rng, stream.MinValue, stream.MaxValue)))
+		}
+		out = append(out, v)
+	}
+	return out
+}
+
+func between(rng *rand.Rand, minValue, maxValue int16) int16 {
+	if maxValue <= minValue {
+		return minValue
+	}
+	return minValue + int16(rng.Intn(int(maxValue-minValue)))
+}
+
+// nonZero draws from [minValue, maxValue) skipping zero.
+func nonZero(rng *rand.Rand, minValue, maxValue int16) int16 {
+	count := int(maxValue - minValue)
+	if minValue <= 0 && maxValue > 0 {
+		count--
+	}
+	if count <= 0 {
+		return max(minValue, 1)
+	}
+
+	v := minValue + int16(rng.Intn(count))
+	if v >= 0 && minValue <= 0 && maxValue > 0 {
+		v++
+	}
+	return v
+}
+
+// weight returns the weight of the i-th choice, missing weights count
+// as 1.
+func weight(weights []uint16, i int) int {
+	if i < len(weights) {
+		return int(weights[i])
+	}
+	return 1
+}
+
+func findStream(streams []emu.Stream, index uint8) (emu.Stream, bool) {
+	for _, stream := range streams {
+		if stream.Type == emu.IN && stream.Index == index {
+			return stream, true
+		}
+	}
+	return emu.Stream{}, false
+}
+
+func findValues(streams []emu.Stream, index uint8) []int16 {
+	for _, stream := range streams {
+		if stream.Type == emu.IN && stream.Index == index {
+			return stream.Values
+		}
+	}
+	return nil
+}
+
+func clamp(v int) int16 {
+	return int16(min(max(v, emu.MinACC), emu.MaxACC))
+}
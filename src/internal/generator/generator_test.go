@@ -0,0 +1,290 @@
+package generator
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/franchesko/assembly-labyrinth/src/internal/emu"
+)
+
+const seeds = 500
+
+func generate(streams []emu.Stream, seed int64) []emu.Stream {
+	generated := make([]emu.Stream, len(streams))
+	copy(generated, streams)
+	Generate(generated, seed)
+	return generated
+}
+
+func TestGenerateSameSeed(t *testing.T) {
+	streams := []emu.Stream{
+		{Index: 0, Type: emu.IN, MinValue: -50, MaxValue: 50},
+		{Index: 1, Type: emu.IN, MinValue: 1, MaxValue: 10, Generator: &emu.Generator{Kind: emu.SEQUENCE}},
+		{Index: 2, Type: emu.IN, MinValue: 0, MaxValue: 5, Generator: &emu.Generator{Kind: emu.DERIVED, Source: 0, Derive: emu.JITTER}},
+		{Index: 10, Type: emu.OUT},
+	}
+
+	for seed := range int64(seeds) {
+		first := generate(streams, seed)
+		second := generate(streams, seed)
+		if !reflect.DeepEqual(first, second) {
+			t.Fatalf("seed %d generated %v and %v", seed, first, second)
+		}
+		if first[3].Values != nil {
+			t.Fatalf("seed %d filled the output stream", seed)
+		}
+	}
+
+	if reflect.DeepEqual(generate(streams, 1), generate(streams, 2)) {
+		t.Error("seeds 1 and 2 generated the same values")
+	}
+}
+
+func TestGenerateKinds(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream emu.Stream
+		check  func(values []int16) bool
+	}{
+		{
+			name:   "uniform",
+			stream: emu.Stream{MinValue: -3, MaxValue: 3},
+			check:  inRange(-3, 3),
+		},
+		{
+			name:   "constant",
+			stream: emu.Stream{Generator: &emu.Generator{Kind: emu.CONSTANT, Value: 42}},
+			check: func(values []int16) bool {
+				return !slices.ContainsFunc(values, func(v int16) bool { return v != 42 })
+			},
+		},
+		{
+			name:   "sorted",
+			stream: emu.Stream{MinValue: 0, MaxValue: 100, Generator: &emu.Generator{Kind: emu.SORTED}},
+			check: func(values []int16) bool {
+				return slices.IsSorted(values) && inRange(0, 100)(values)
+			},
+		},
+		{
+			name:   "sorted descending",
+			stream: emu.Stream{MinValue: 0, MaxValue: 100, Generator: &emu.Generator{Kind: emu.SORTED, Descending: true}},
+			check: func(values []int16) bool {
+				reversed := slices.Clone(values)
+				slices.Reverse(reversed)
+				return slices.IsSorted(reversed) && inRange(0, 100)(values)
+			},
+		},
+		{
+			name:   "unique",
+			stream: emu.Stream{MinValue: -10, MaxValue: 10, Generator: &emu.Generator{Kind: emu.UNIQUE}},
+			check: func(values []int16) bool {
+				sorted := slices.Clone(values)
+				slices.Sort(sorted)
+				return len(slices.Compact(sorted)) == len(values) && inRange(-10, 10)(values)
+			},
+		},
+		{
+			name:   "choice",
+			stream: emu.Stream{Generator: &emu.Generator{Kind: emu.CHOICE, Values: []int16{-1, 0, 1}, Weights: []uint16{1, 0}}},
+			check: func(values []int16) bool {
+				return !slices.ContainsFunc(values, func(v int16) bool { return v != -1 && v != 1 })
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.stream.Type = emu.IN
+			for seed := range int64(seeds) {
+				values := generate([]emu.Stream{tt.stream}, seed)[0].Values
+				if len(values) != emu.StreamLength {
+					t.Fatalf("seed %d: got %d values, want %d", seed, len(values), emu.StreamLength)
+				}
+				if !tt.check(values) {
+					t.Fatalf("seed %d: unexpected values %v", seed, values)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateSequence(t *testing.T) {
+	tests := []struct {
+		name      string
+		minLength uint8
+		maxLength uint8
+		lo, hi    int
+	}{
+		{name: "defaults", lo: defaultMinLength, hi: defaultMaxLength},
+		{name: "three to five", minLength: 3, maxLength: 5, lo: 3, hi: 5},
+		{name: "fixed length", minLength: 4, maxLength: 4, lo: 4, hi: 4},
+		{name: "single values", minLength: 1, maxLength: 1, lo: 1, hi: 1},
+		{name: "one run", minLength: 19, maxLength: 19, lo: 19, hi: 19},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream := emu.Stream{
+				Type:     emu.IN,
+				MinValue: -5,
+				MaxValue: 5,
+				Generator: &emu.Generator{
+					Kind:      emu.SEQUENCE,
+					MinLength: tt.minLength,
+					MaxLength: tt.maxLength,
+				},
+			}
+			for seed := range int64(seeds) {
+				values := generate([]emu.Stream{stream}, seed)[0].Values
+				if len(values) != emu.StreamLength || values[len(values)-1] != 0 {
+					t.Fatalf("seed %d: %v is not a terminated stream of %d values", seed, values, emu.StreamLength)
+				}
+				length := 0
+				for _, v := range values {
+					if v != 0 {
+						if v < -5 || v >= 5 {
+							t.Fatalf("seed %d: value %d is out of range", seed, v)
+						}
+						length++
+						continue
+					}
+					if length < tt.lo || length > tt.hi {
+						t.Fatalf("seed %d: run of %d values in %v, want %d to %d", seed, length, values, tt.lo, tt.hi)
+					}
+					length = 0
+				}
+			}
+		})
+	}
+}
+
+func TestSequenceFits(t *testing.T) {
+	tests := []struct {
+		minLength uint8
+		maxLength uint8
+		want      bool
+	}{
+		{0, 0, true},
+		{3, 5, true},
+		{4, 4, true},
+		{5, 5, false},
+		{2, 2, false},
+		{19, 19, true},
+		{20, 25, false},
+	}
+
+	for _, tt := range tests {
+		if got := SequenceFits(tt.minLength, tt.maxLength); got != tt.want {
+			t.Errorf("SequenceFits(%d, %d) = %t, want %t", tt.minLength, tt.maxLength, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateDerived(t *testing.T) {
+	tests := []struct {
+		name    string
+		derived emu.Stream
+		check   func(source, v int16) bool
+	}{
+		{
+			name:    "negate",
+			derived: emu.Stream{Generator: &emu.Generator{Kind: emu.DERIVED, Derive: emu.NEGATE}},
+			check:   func(source, v int16) bool { return v == -source },
+		},
+		{
+			name:    "offset",
+			derived: emu.Stream{Generator: &emu.Generator{Kind: emu.DERIVED, Derive: emu.OFFSET, Value: 990}},
+			check:   func(source, v int16) bool { return v == min(source+990, emu.MaxACC) },
+		},
+		{
+			name:    "jitter",
+			derived: emu.Stream{MinValue: -2, MaxValue: 3, Generator: &emu.Generator{Kind: emu.DERIVED, Derive: emu.JITTER}},
+			check:   func(source, v int16) bool { return v-source >= -2 && v-source < 3 },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.derived.Index = 1
+			tt.derived.Type = emu.IN
+			streams := []emu.Stream{
+				tt.derived,
+				{Index: 0, Type: emu.IN, MinValue: -50, MaxValue: 50},
+			}
+			for seed := range int64(seeds) {
+				generated := generate(streams, seed)
+				source, values := generated[1].Values, generated[0].Values
+				if len(values) != len(source) {
+					t.Fatalf("seed %d: got %d values, want %d", seed, len(values), len(source))
+				}
+				for i := range values {
+					if !tt.check(source[i], values[i]) {
+						t.Fatalf("seed %d: value %d is %d for source %d", seed, i, values[i], source[i])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestRederive(t *testing.T) {
+	streams := []emu.Stream{
+		{Index: 0, Type: emu.IN, MinValue: -10, MaxValue: 10},
+		{Index: 1, Type: emu.IN, Generator: &emu.Generator{Kind: emu.DERIVED, Source: 0, Derive: emu.NEGATE}},
+		{Index: 2, Type: emu.IN, Generator: &emu.Generator{Kind: emu.DERIVED, Source: 1, Derive: emu.OFFSET, Value: 5}},
+		{Index: 3, Type: emu.IN, MinValue: -10, MaxValue: 10},
+	}
+	tests := []struct {
+		name    string
+		changed map[uint8][]int16
+		want    map[uint8][]int16
+	}{
+		{
+			name:    "source",
+			changed: map[uint8][]int16{0: {1, 2, 3}},
+			want:    map[uint8][]int16{0: {1, 2, 3}, 1: {-1, -2, -3}, 2: {4, 3, 2}},
+		},
+		{
+			name:    "derived stream",
+			changed: map[uint8][]int16{1: {7, 8}},
+			want:    map[uint8][]int16{1: {7, 8}, 2: {12, 13}},
+		},
+		{
+			name:    "source and derived stream",
+			changed: map[uint8][]int16{0: {1, 2, 3}, 2: {100}},
+			want:    map[uint8][]int16{0: {1, 2, 3}, 1: {-1, -2, -3}, 2: {100}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			generated := generate(streams, 1)
+			changed := make(map[uint8]bool)
+			for i := range generated {
+				if values, ok := tt.changed[generated[i].Index]; ok {
+					generated[i].Values = values
+					changed[generated[i].Index] = true
+				}
+			}
+			Rederive(generated, changed, 1)
+
+			untouched := generate(streams, 1)
+			for i, stream := range generated {
+				want, ok := tt.want[stream.Index]
+				if !ok {
+					want = untouched[i].Values
+				}
+				if !slices.Equal(stream.Values, want) {
+					t.Errorf("stream %d = %v, want %v", stream.Index, stream.Values, want)
+				}
+			}
+		})
+	}
+}
+
+func inRange(lo, hi int16) func([]int16) bool {
+	return func(values []int16) bool {
+		return !slices.ContainsFunc(values, func(v int16) bool { return v < lo || v >= hi })
+	}
+}
@@ -0,0 +1,197 @@
+package levels
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/franchesko/assembly-labyrinth/src/internal/config"
+	"github.com/franchesko/assembly-labyrinth/src/internal/emu"
+	"github.com/franchesko/assembly-labyrinth/src/internal/files"
+)
+
+// Level is a level definition together with its reference solution.
+type Level struct {
+	info      files.LevelInfo
+	Reference []emu.NodeCode
+}
+
+// Info returns the level definition. Its streams are copied, so the caller
+// may fill them with values.
+func (l *Level) Info() files.LevelInfo {
+	info := l.info
+	info.Streams = make([]emu.Stream, len(l.info.Streams))
+	copy(info.Streams, l.info.Streams)
+	return info
+}
+
+// Snapshot holds every level loaded at the same time. It is not modified
+// once loaded and is safe for concurrent use.
+type Snapshot struct {
+	Levels    map[string]*Level
+	Catalogue []Entry
+	Report    *Report
+}
+
+var (
+	ErrNotFound = errors.New("level not found")
+	ErrBroken   = errors.New("level is broken")
+)
+
+// Resolve returns the loaded level with the given id. Ids that are not in
+// the snapshot are never looked up on disk.
+func (s *Snapshot) Resolve(id string) (*Level, error) {
+	if s.Report.Broken(id) {
+		return nil, ErrBroken
+	}
+	level, ok := s.Levels[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return level, nil
+}
+
+// Cache keeps the current snapshot of the levels and replaces it when the
+// files in cfg.LevelPath or cfg.CodePath change.
+type Cache struct {
+	cfg      *config.Config
+	snapshot atomic.Pointer[Snapshot]
+	stamp    string
+}
+
+func NewCache(cfg *config.Config) (*Cache, error) {
+	c := &Cache{
+		cfg: cfg,
+	}
+	if _, err := c.reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Cache) Snapshot() *Snapshot {
+	return c.snapshot.Load()
+}
+
+// reload loads and validates all levels and swaps them in. The current
+// snapshot is kept if the levels cannot be listed.
+func (c *Cache) reload() (*Snapshot, error) {
+	stamp, err := dirStamp(c.cfg.LevelPath, c.cfg.CodePath)
+	if err != nil {
+		return nil, err
+	}
+	snapshot, err := Load(c.cfg)
+	if err != nil {
+		return nil, err
+	}
+	c.snapshot.Store(snapshot)
+	c.stamp = stamp
+	return snapshot, nil
+}
+
+// Watch polls the level and code directories every interval and reloads
+// the levels when a file is added, removed or modified. It returns when
+// ctx is done.
+func (c *Cache) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		stamp, err := dirStamp(c.cfg.LevelPath, c.cfg.CodePath)
+		if err != nil {
+			log.Printf("could not check levels: %s", err)
+			continue
+		}
+		if stamp == c.stamp {
+			continue
+		}
+
+		snapshot, err := c.reload()
+		if err != nil {
+			log.Printf("could not reload levels: %s", err)
+			continue
+		}
+		log.Printf("levels reloaded: %s", snapshot.Report)
+	}
+}
+
+// Load reads every level in cfg.LevelPath together with its reference
+// solution in cfg.CodePath and validates them.
+func Load(cfg *config.Config) (*Snapshot, error) {
+	ids, err := files.LoadLevels(cfg.LevelPath)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &Snapshot{
+		Levels:    make(map[string]*Level),
+		Catalogue: make([]Entry, 0, len(ids)),
+		Report:    NewReport(),
+	}
+	infos := make(map[string]files.LevelInfo)
+	for _, id := range ids {
+		info, err := files.LoadLevelInfo(cfg.LevelPath + "/" + id + ".json")
+		if err != nil {
+			snapshot.Report.Add(id, fmt.Sprintf("unable to load level: %s", err))
+			continue
+		}
+		infos[id] = info
+		problems := validateInfo(info)
+		code, err := files.LoadNodesCode(cfg.CodePath + "/" + id + ".json")
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("unable to load reference solution: %s", err))
+		} else if len(problems) == 0 {
+			problems = validateSolution(cfg, info, code)
+		}
+		snapshot.Report.Add(id, problems...)
+		snapshot.Levels[id] = &Level{
+			info:      info,
+			Reference: code,
+		}
+	}
+
+	for _, id := range ids {
+		snapshot.Report.Add(id, validatePrerequisites(id, infos)...)
+	}
+	reportDependents(snapshot.Report, ids, infos)
+
+	for _, id := range ids {
+		if level, ok := snapshot.Levels[id]; ok && !snapshot.Report.Broken(id) {
+			snapshot.Catalogue = append(snapshot.Catalogue, NewEntry(id, level.info))
+		}
+	}
+	SortEntries(snapshot.Catalogue)
+
+	return snapshot, nil
+}
+
+// dirStamp describes the names, sizes and modification times of the files
+// in dirs, so any change to them changes the stamp.
+func dirStamp(dirs ...string) (string, error) {
+	var sb strings.Builder
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return "", err
+		}
+		for _, entry := range entries {
+			info, err := entry.Info()
+			if err != nil {
+				return "", err
+			}
+			fmt.Fprintf(&sb, "%s/%s:%d:%d\n", dir, entry.Name(), info.Size(), info.ModTime().UnixNano())
+		}
+	}
+	return sb.String(), nil
+}
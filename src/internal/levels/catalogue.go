@@ -0,0 +1,48 @@
+package levels
+
+import (
+	"math"
+	"sort"
+
+	"github.com/franchesko/assembly-labyrinth/src/internal/files"
+)
+
+// Entry describes a level in the catalogue without its full definition.
+// The catalogue only lists levels that are not broken, sorted by their
+// order. Levels without an order come last and are sorted by id.
+type Entry struct {
+	ID            string
+	Title         string
+	Difficulty    uint8
+	Tags          []string
+	Order         int
+	Prerequisites []string
+}
+
+func NewEntry(id string, info files.LevelInfo) Entry {
+	return Entry{
+		ID:            id,
+		Title:         info.Title,
+		Difficulty:    info.Difficulty,
+		Tags:          info.Tags,
+		Order:         info.Order,
+		Prerequisites: info.Prerequisites,
+	}
+}
+
+func SortEntries(entries []Entry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		oi, oj := sortOrder(entries[i].Order), sortOrder(entries[j].Order)
+		if oi != oj {
+			return oi < oj
+		}
+		return entries[i].ID < entries[j].ID
+	})
+}
+
+func sortOrder(order int) int {
+	if order == 0 {
+		return math.MaxInt
+	}
+	return order
+}
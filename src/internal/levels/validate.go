@@ -0,0 +1,343 @@
+package levels
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/franchesko/assembly-labyrinth/src/internal/config"
+	"github.com/franchesko/assembly-labyrinth/src/internal/emu"
+	"github.com/franchesko/assembly-labyrinth/src/internal/emu/program"
+	"github.com/franchesko/assembly-labyrinth/src/internal/files"
+	"github.com/franchesko/assembly-labyrinth/src/internal/generator"
+)
+
+// validationSeed is used to generate the inputs the reference solution is
+// checked with.
+const validationSeed = 1
+
+// Report lists the problems found in every broken level. Levels without
+// problems are not mentioned.
+type Report struct {
+	Problems map[string][]string
+}
+
+func NewReport() *Report {
+	return &Report{
+		Problems: make(map[string][]string),
+	}
+}
+
+func (r *Report) Add(level string, problems ...string) {
+	if len(problems) > 0 {
+		r.Problems[level] = append(r.Problems[level], problems...)
+	}
+}
+
+func (r *Report) Broken(level string) bool {
+	return len(r.Problems[level]) > 0
+}
+
+func (r *Report) String() string {
+	if len(r.Problems) == 0 {
+		return "all levels are valid"
+	}
+
+	levels := make([]string, 0, len(r.Problems))
+	for level := range r.Problems {
+		levels = append(levels, level)
+	}
+	sort.Strings(levels)
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%d broken level(s):", len(levels))
+	for _, level := range levels {
+		fmt.Fprintf(&sb, "\n  %s:", level)
+		for _, problem := range r.Problems[level] {
+			fmt.Fprintf(&sb, "\n    - %s", problem)
+		}
+	}
+	return sb.String()
+}
+
+// validatePrerequisites checks that the prerequisites of a level exist and
+// that the level does not depend on itself.
+func validatePrerequisites(id string, infos map[string]files.LevelInfo) []string {
+	problems := make([]string, 0)
+	for _, prerequisite := range infos[id].Prerequisites {
+		if _, ok := infos[prerequisite]; !ok {
+			problems = append(problems, fmt.Sprintf("prerequisite %q does not exist", prerequisite))
+		}
+	}
+
+	visited := make(map[string]bool)
+	queue := append([]string(nil), infos[id].Prerequisites...)
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		if current == id {
+			problems = append(problems, "prerequisites form a cycle")
+			break
+		}
+		if visited[current] {
+			continue
+		}
+		visited[current] = true
+		queue = append(queue, infos[current].Prerequisites...)
+	}
+
+	return problems
+}
+
+// reportDependents marks the levels that depend on a broken level, directly
+// or through other levels, as broken too since they can never be unlocked.
+func reportDependents(report *Report, ids []string, infos map[string]files.LevelInfo) {
+	for changed := true; changed; {
+		changed = false
+		for _, id := range ids {
+			if report.Broken(id) {
+				continue
+			}
+			for _, prerequisite := range infos[id].Prerequisites {
+				if report.Broken(prerequisite) {
+					report.Add(id, fmt.Sprintf("prerequisite %q is broken", prerequisite))
+					changed = true
+					break
+				}
+			}
+		}
+	}
+}
+
+// Validate checks the level definition and runs the reference solution on
+// generated and hand-written inputs. It returns the problems found.
+func Validate(cfg *config.Config, info files.LevelInfo, code []emu.NodeCode) []string {
+	if problems := validateInfo(info); len(problems) > 0 {
+		return problems
+	}
+	return validateSolution(cfg, info, code)
+}
+
+func validateSolution(cfg *config.Config, info files.LevelInfo, code []emu.NodeCode) []string {
+	problems := make([]string, 0)
+	streams := make([]emu.Stream, len(info.Streams))
+	copy(streams, info.Streams)
+	generator.Generate(streams, validationSeed)
+	if problem := validateReference(cfg, info, streams, code); problem != "" {
+		problems = append(problems, "generated inputs: "+problem)
+	}
+
+	for i, test := range info.Tests {
+		tested := make([]emu.Stream, len(streams))
+		copy(tested, streams)
+		test.Apply(tested)
+		generator.Rederive(tested, test.Overrides(), validationSeed)
+		if problem := validateReference(cfg, info, tested, code); problem != "" {
+			problems = append(problems, fmt.Sprintf("test %d: %s", i, problem))
+		}
+	}
+
+	return problems
+}
+
+func validateInfo(info files.LevelInfo) []string {
+	problems := make([]string, 0)
+	if info.Title == "" {
+		problems = append(problems, "title is empty")
+	}
+
+	damaged := make(map[uint8]bool)
+	seenNodes := make(map[uint8]bool)
+	for _, nl := range info.Layout {
+		if nl.Index >= emu.NodesNumber {
+			problems = append(problems, fmt.Sprintf("layout: node index %d is outside 0-%d", nl.Index, emu.NodesNumber-1))
+			continue
+		}
+		if seenNodes[nl.Index] {
+			problems = append(problems, fmt.Sprintf("layout: node %d is listed twice", nl.Index))
+		}
+		if nl.Type != emu.COMPUTE && nl.Type != emu.DAMAGED {
+			problems = append(problems, fmt.Sprintf("layout: node %d has unknown type %d", nl.Index, nl.Type))
+		}
+		seenNodes[nl.Index] = true
+		damaged[nl.Index] = nl.Type == emu.DAMAGED
+	}
+
+	inputs := make(map[uint8]emu.Stream)
+	outputs := 0
+	seenStreams := make(map[uint8]bool)
+	for _, stream := range info.Streams {
+		if stream.Index >= emu.NodesNumber {
+			problems = append(problems, fmt.Sprintf("stream %d: index is outside 0-%d", stream.Index, emu.NodesNumber-1))
+			continue
+		}
+		if seenStreams[stream.Index] {
+			problems = append(problems, fmt.Sprintf("stream %d: index is used twice", stream.Index))
+		}
+		seenStreams[stream.Index] = true
+		if damaged[stream.Index] {
+			problems = append(problems, fmt.Sprintf("stream %d: node %d is damaged", stream.Index, stream.Index))
+		}
+
+		switch stream.Type {
+		case emu.IN:
+			if stream.Index >= 4 {
+				problems = append(problems, fmt.Sprintf("stream %d: input streams must be attached to the top row", stream.Index))
+			}
+			inputs[stream.Index] = stream
+		case emu.OUT:
+			if stream.Index < emu.NodesNumber-4 {
+				problems = append(problems, fmt.Sprintf("stream %d: output streams must be attached to the bottom row", stream.Index))
+			}
+			outputs++
+		default:
+			problems = append(problems, fmt.Sprintf("stream %d: unknown type %d", stream.Index, stream.Type))
+		}
+	}
+	if len(inputs) == 0 {
+		problems = append(problems, "level has no input streams")
+	}
+	if outputs == 0 {
+		problems = append(problems, "level has no output streams")
+	}
+
+	for _, stream := range info.Streams {
+		if stream.Type != emu.IN || stream.Index >= emu.NodesNumber {
+			continue
+		}
+		for _, problem := range validateGenerator(stream, inputs) {
+			problems = append(problems, fmt.Sprintf("stream %d: %s", stream.Index, problem))
+		}
+	}
+
+	for i, test := range info.Tests {
+		if len(test.In) == 0 {
+			problems = append(problems, fmt.Sprintf("test %d: no input values", i))
+		}
+		for _, in := range test.In {
+			if _, ok := inputs[in.Index]; !ok {
+				problems = append(problems, fmt.Sprintf("test %d: stream %d is not an input stream", i, in.Index))
+			}
+			for _, v := range in.Values {
+				if !inACCRange(v) {
+					problems = append(problems, fmt.Sprintf("test %d: value %d of stream %d is out of range", i, v, in.Index))
+					break
+				}
+			}
+		}
+	}
+
+	return problems
+}
+
+func validateGenerator(stream emu.Stream, inputs map[uint8]emu.Stream) []string {
+	problems := make([]string, 0)
+	gen := stream.Generator
+	kind := emu.UNIFORM
+	if gen != nil {
+		kind = gen.Kind
+	}
+
+	needsRange := kind == emu.UNIFORM || kind == emu.SEQUENCE || kind == emu.SORTED || kind == emu.UNIQUE ||
+		(kind == emu.DERIVED && gen.Derive == emu.JITTER)
+	if needsRange {
+		if stream.MinValue >= stream.MaxValue {
+			problems = append(problems, "min_value must be less than max_value")
+		}
+		if !inACCRange(stream.MinValue) || !inACCRange(stream.MaxValue-1) {
+			problems = append(problems, "value range is outside the register range")
+		}
+	}
+
+	switch kind {
+	case emu.UNIFORM, emu.SORTED:
+	case emu.CONSTANT:
+		if !inACCRange(gen.Value) {
+			problems = append(problems, "constant value is out of range")
+		}
+	case emu.SEQUENCE:
+		if stream.MinValue == 0 && stream.MaxValue == 1 {
+			problems = append(problems, "sequence range has no non-zero values")
+		}
+		if gen.MaxLength != 0 && gen.MaxLength < gen.MinLength {
+			problems = append(problems, "max_length must not be less than min_length")
+		} else if !generator.SequenceFits(gen.MinLength, gen.MaxLength) {
+			problems = append(problems, fmt.Sprintf("runs of min_length to max_length values cannot fill %d values", emu.StreamLength))
+		}
+	case emu.UNIQUE:
+		if int(stream.MaxValue)-int(stream.MinValue) < emu.StreamLength {
+			problems = append(problems, fmt.Sprintf("range must hold at least %d distinct values", emu.StreamLength))
+		}
+	case emu.CHOICE:
+		if len(gen.Values) == 0 {
+			problems = append(problems, "choice has no values")
+		}
+		if len(gen.Weights) > len(gen.Values) {
+			problems = append(problems, "choice has more weights than values")
+		}
+		total := 0
+		for i := range gen.Values {
+			if !inACCRange(gen.Values[i]) {
+				problems = append(problems, fmt.Sprintf("choice value %d is out of range", gen.Values[i]))
+			}
+			if i < len(gen.Weights) {
+				total += int(gen.Weights[i])
+			} else {
+				total++
+			}
+		}
+		if len(gen.Values) > 0 && total == 0 {
+			problems = append(problems, "choice weights are all zero")
+		}
+	case emu.DERIVED:
+		if gen.Derive > emu.JITTER {
+			problems = append(problems, fmt.Sprintf("unknown derive operation %d", gen.Derive))
+		}
+		seen := map[uint8]bool{stream.Index: true}
+		for source := gen.Source; ; {
+			src, ok := inputs[source]
+			if !ok {
+				problems = append(problems, fmt.Sprintf("source %d is not an input stream", source))
+				break
+			}
+			if seen[source] {
+				problems = append(problems, "derived streams form a cycle")
+				break
+			}
+			if src.Generator == nil || src.Generator.Kind != emu.DERIVED {
+				break
+			}
+			seen[source] = true
+			source = src.Generator.Source
+		}
+	default:
+		problems = append(problems, fmt.Sprintf("unknown generator kind %d", kind))
+	}
+
+	return problems
+}
+
+// validateReference runs the reference solution and reports a problem if
+// it fails or leaves an output stream empty.
+func validateReference(cfg *config.Config, info files.LevelInfo, streams []emu.Stream, code []emu.NodeCode) string {
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.RunTimeout)
+	defer cancel()
+
+	res, err := program.Run(ctx, info.Layout, streams, code, program.Options{
+		MaxCycles: cfg.MaxCycles,
+	})
+	if err != nil {
+		return fmt.Sprintf("reference solution failed: %s", err)
+	}
+	for _, out := range res.Output {
+		if len(out.Values) == 0 {
+			return fmt.Sprintf("reference solution wrote nothing to stream %d", out.Index)
+		}
+	}
+	return ""
+}
+
+func inACCRange(v int16) bool {
+	return v >= emu.MinACC && v <= emu.MaxACC
+}
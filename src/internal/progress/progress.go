@@ -0,0 +1,82 @@
+package progress
+
+import (
+	"sync"
+
+	"github.com/franchesko/assembly-labyrinth/src/internal/levels"
+)
+
+// PlayerHeader is the request header that identifies a player. Requests
+// without it count as a player who has solved nothing, their runs are not
+// recorded.
+const PlayerHeader = "X-Player-ID"
+
+type LevelStatus struct {
+	ID     string
+	Solved bool
+	Locked bool
+}
+
+// Tracker keeps the levels every player has solved. It is safe for
+// concurrent use.
+type Tracker struct {
+	mu     sync.RWMutex
+	solved map[string]map[string]bool
+}
+
+func NewTracker() *Tracker {
+	return &Tracker{
+		solved: make(map[string]map[string]bool),
+	}
+}
+
+func (t *Tracker) MarkSolved(player, level string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.solved[player] == nil {
+		t.solved[player] = make(map[string]bool)
+	}
+	t.solved[player][level] = true
+}
+
+func (t *Tracker) Solved(player string) map[string]bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	solved := make(map[string]bool, len(t.solved[player]))
+	for level := range t.solved[player] {
+		solved[level] = true
+	}
+	return solved
+}
+
+// Locked reports whether the player has not solved every prerequisite
+// of the level yet.
+func (t *Tracker) Locked(player string, prerequisites []string) bool {
+	return locked(prerequisites, t.Solved(player))
+}
+
+// Status reports which levels of the catalogue the player has solved and
+// which are still locked.
+func (t *Tracker) Status(player string, entries []levels.Entry) []LevelStatus {
+	solved := t.Solved(player)
+	status := make([]LevelStatus, 0, len(entries))
+	for _, entry := range entries {
+		status = append(status, LevelStatus{
+			ID:     entry.ID,
+			Solved: solved[entry.ID],
+			Locked: locked(entry.Prerequisites, solved),
+		})
+	}
+	return status
+}
+
+func locked(prerequisites []string, solved map[string]bool) bool {
+	for _, prerequisite := range prerequisites {
+		if !solved[prerequisite] {
+			return true
+		}
+	}
+	return false
+}
@@ -1,11 +1,15 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 
 	"github.com/franchesko/assembly-labyrinth/src/internal/api"
 	"github.com/franchesko/assembly-labyrinth/src/internal/config"
+	"github.com/franchesko/assembly-labyrinth/src/internal/debug"
+	"github.com/franchesko/assembly-labyrinth/src/internal/levels"
+	"github.com/franchesko/assembly-labyrinth/src/internal/progress"
 	"github.com/gorilla/mux"
 	"github.com/rs/cors"
 )
@@ -13,11 +17,37 @@ import (
 func main() {
 	cfg := config.MustLoad()
 
+	cache, err := levels.NewCache(cfg)
+	if err != nil {
+		log.Fatalf("could not load levels: %s", err)
+	}
+	log.Printf("level validation: %s", cache.Snapshot().Report)
+	if cfg.ReloadInterval > 0 {
+		go cache.Watch(context.Background(), cfg.ReloadInterval)
+	}
+
+	tracker := progress.NewTracker()
+	sessions := debug.NewStore(cfg.SessionTTL, cfg.MaxSessions)
+
 	muxRouter := mux.NewRouter()
-	muxRouter.HandleFunc("/levels", api.GetLevelsHandler(cfg)).Methods("GET")
-	muxRouter.HandleFunc("/levels/{level}", api.GetLevelInfoHandler(cfg)).Methods("GET")
-	muxRouter.HandleFunc("/levels/{level}", api.GetRunLevelHandler(cfg)).Methods("POST")
+	muxRouter.NotFoundHandler = api.NotFoundHandler()
+	muxRouter.MethodNotAllowedHandler = api.MethodNotAllowedHandler()
+	muxRouter.HandleFunc("/levels", api.GetLevelsHandler(cache)).Methods("GET")
+	muxRouter.HandleFunc("/levels/{level}", api.GetLevelInfoHandler(cfg, cache)).Methods("GET")
+	muxRouter.HandleFunc("/levels/{level}", api.GetRunLevelHandler(cfg, cache, tracker)).Methods("POST")
+	muxRouter.HandleFunc("/levels/{level}/trace", api.GetTraceLevelHandler(cfg, cache, tracker)).Methods("POST")
+	muxRouter.HandleFunc("/progress", api.GetProgressHandler(cache, tracker)).Methods("GET")
+	muxRouter.HandleFunc("/levels/{level}/debug", api.GetCreateDebugSessionHandler(cfg, cache, tracker, sessions)).Methods("POST")
+	muxRouter.HandleFunc("/debug/{session}", api.GetDebugSessionHandler(sessions)).Methods("GET")
+	muxRouter.HandleFunc("/debug/{session}", api.GetDeleteDebugSessionHandler(sessions)).Methods("DELETE")
+	muxRouter.HandleFunc("/debug/{session}/conditions", api.GetSetDebugConditionsHandler(sessions)).Methods("PUT")
+	muxRouter.HandleFunc("/debug/{session}/step", api.GetStepDebugSessionHandler(cfg, sessions)).Methods("POST")
+	muxRouter.HandleFunc("/debug/{session}/continue", api.GetContinueDebugSessionHandler(cfg, sessions)).Methods("POST")
 
-	router := cors.Default().Handler(muxRouter)
+	router := cors.New(cors.Options{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete},
+		AllowedHeaders: []string{"*"},
+	}).Handler(muxRouter)
 	log.Fatal(http.ListenAndServe(cfg.Address+":"+cfg.Port, router))
 }